@@ -2,15 +2,20 @@ package testutils
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // CaptureStdout captures the output of a function that writes to stdout.
 // All Capture functions are not thread-safe if used in parallel tests.
-// Usually it is better to pass a custom io.Writer to the function under test instead.
+// Usually it is better to pass a custom io.Writer to the function under test instead,
+// see CaptureOutput.
 func CaptureStdout(t *testing.T, f func()) string {
 	t.Helper()
 	return capture(t, os.Stdout, f)
@@ -26,75 +31,458 @@ func CaptureStderr(t *testing.T, f func()) string {
 // stdout and stderr.
 func CaptureStdoutAndStderr(t *testing.T, f func()) (o, e string) {
 	t.Helper()
+	var outBuf, errBuf bytes.Buffer
+	p := captureTo(t, f, redirect{files: []*os.File{os.Stdout}, dst: &outBuf},
+		redirect{files: []*os.File{os.Stderr}, dst: &errBuf})
+	repanic(t, p, outBuf.String()+errBuf.String())
+	return outBuf.String(), errBuf.String()
+}
+
+// CaptureStdoutRecover captures the output of a function that writes to stdout.
+// If f panics, the panic is recovered and its value returned along with the output captured before it.
+// Other Capture functions restore the streams and re-raise the panic.
+func CaptureStdoutRecover(t *testing.T, f func()) (out string, recovered any) {
+	t.Helper()
+	return captureRecover(t, os.Stdout, f)
+}
+
+// CaptureStderrRecover captures the output of a function that writes to stderr.
+// If f panics, the panic is recovered and its value returned along with the output captured before it.
+func CaptureStderrRecover(t *testing.T, f func()) (out string, recovered any) {
+	t.Helper()
+	return captureRecover(t, os.Stderr, f)
+}
+
+// CaptureStdoutE captures the output of a function that writes to stdout and returns
+// the error returned by the function.
+func CaptureStdoutE(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	var err error
+	out := CaptureStdout(t, func() { err = f() })
+	return out, err
+}
+
+// CaptureStderrE captures the output of a function that writes to stderr and returns
+// the error returned by the function.
+func CaptureStderrE(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	var err error
+	out := CaptureStderr(t, func() { err = f() })
+	return out, err
+}
+
+// CaptureStdoutAndStderrE captures the output of a function that writes to stdout and stderr
+// and returns the error returned by the function.
+func CaptureStdoutAndStderrE(t *testing.T, f func() error) (o, e string, err error) {
+	t.Helper()
+	o, e = CaptureStdoutAndStderr(t, func() { err = f() })
+	return o, e, err
+}
+
+// CaptureCombined captures the output of a function that writes to stdout and stderr
+// into a single string, preserving the order of writes, like exec.Cmd.CombinedOutput.
+func CaptureCombined(t *testing.T, f func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	p := captureTo(t, f, redirect{files: []*os.File{os.Stdout, os.Stderr}, dst: &buf})
+	repanic(t, p, buf.String())
+	return buf.String()
+}
 
-	oldout, olderr := os.Stdout, os.Stderr
-	rOut, wOut, err := os.Pipe()
+// CaptureDiscard silences stdout and stderr while f is running. The output is written to os.DevNull
+// without buffering, so it can be used in benchmarks to keep noisy code from skewing timings.
+func CaptureDiscard(tb testing.TB, f func()) {
+	tb.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	oldOut, oldErr := *os.Stdout, *os.Stderr
+	*os.Stdout, *os.Stderr = *devNull, *devNull
+	defer func() {
+		*os.Stdout, *os.Stderr = oldOut, oldErr
+		devNull.Close()
+	}()
+	f()
+}
+
+// CaptureOutput captures the output written by f to the io.Writer passed to it.
+// Unlike other Capture functions it doesn't touch os.Stdout or os.Stderr,
+// so it is safe to use in parallel tests. The writer can be used from
+// multiple goroutines started by f, as long as they are done before f returns.
+func CaptureOutput(t *testing.T, f func(w io.Writer)) string {
+	t.Helper()
+	buf := &syncBuffer{}
+	f(buf)
+	return buf.String()
+}
+
+// CaptureFrom captures the output of a function that writes to the file referenced by target,
+// e.g. a package-level log sink variable. The variable is replaced with a pipe while f is running,
+// so only writes made through the variable are captured, not through copies of the pointer taken before.
+func CaptureFrom(t *testing.T, target **os.File, f func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	p := func() *capturedPanic {
+		w, wait := pipeTo(t, &buf)
+		old := *target
+		*target = w
+		defer func() {
+			*target = old
+			wait()
+		}()
+		return catchPanic(f)
+	}()
+	repanic(t, p, buf.String())
+	return buf.String()
+}
+
+// CaptureStdoutStream calls fn for each line written to stdout by f, as soon as the line is written.
+// Lines are passed without the trailing newline. fn is called from a separate goroutine,
+// so it can report with t.Error but must not call t.Fatal or t.FailNow.
+func CaptureStdoutStream(t *testing.T, f func(), fn func(line string)) {
+	t.Helper()
+	captureStream(t, os.Stdout, f, fn)
+}
+
+// CaptureStderrStream calls fn for each line written to stderr by f, as soon as the line is written.
+func CaptureStderrStream(t *testing.T, f func(), fn func(line string)) {
+	t.Helper()
+	captureStream(t, os.Stderr, f, fn)
+}
+
+// CaptureStdoutN captures up to maxBytes of the output of a function that writes to stdout.
+// Output beyond the limit is discarded and reported by truncated flag.
+func CaptureStdoutN(t *testing.T, f func(), maxBytes int) (out string, truncated bool) {
+	t.Helper()
+	return captureN(t, os.Stdout, f, maxBytes)
+}
+
+// CaptureStderrN captures up to maxBytes of the output of a function that writes to stderr.
+// Output beyond the limit is discarded and reported by truncated flag.
+func CaptureStderrN(t *testing.T, f func(), maxBytes int) (out string, truncated bool) {
+	t.Helper()
+	return captureN(t, os.Stderr, f, maxBytes)
+}
+
+// CaptureStdoutTail captures the last maxBytes of the output of a function that writes to stdout.
+// Earlier output is discarded while f is running, so only the tail is kept in memory.
+func CaptureStdoutTail(t *testing.T, f func(), maxBytes int) string {
+	t.Helper()
+	buf := &tailBuffer{max: maxBytes}
+	p := captureTo(t, f, redirect{files: []*os.File{os.Stdout}, dst: buf})
+	repanic(t, p, buf.String())
+	return buf.String()
+}
+
+// CaptureStderrTail captures the last maxBytes of the output of a function that writes to stderr.
+func CaptureStderrTail(t *testing.T, f func(), maxBytes int) string {
+	t.Helper()
+	buf := &tailBuffer{max: maxBytes}
+	p := captureTo(t, f, redirect{files: []*os.File{os.Stderr}, dst: buf})
+	repanic(t, p, buf.String())
+	return buf.String()
+}
+
+// CaptureStdoutTailLines captures the last n lines of the output of a function that writes to stdout.
+// Lines are returned without the trailing newline.
+func CaptureStdoutTailLines(t *testing.T, f func(), n int) []string {
+	t.Helper()
+	return captureTailLines(t, os.Stdout, f, n)
+}
+
+// CaptureStderrTailLines captures the last n lines of the output of a function that writes to stderr.
+func CaptureStderrTailLines(t *testing.T, f func(), n int) []string {
+	t.Helper()
+	return captureTailLines(t, os.Stderr, f, n)
+}
+
+// CaptureStdoutTee captures the output of a function that writes to stdout
+// and copies it to the original stdout as well, so it is still visible in verbose test runs.
+func CaptureStdoutTee(t *testing.T, f func()) string {
+	t.Helper()
+	return captureTee(t, os.Stdout, f)
+}
+
+// CaptureStderrTee captures the output of a function that writes to stderr
+// and copies it to the original stderr as well.
+func CaptureStderrTee(t *testing.T, f func()) string {
+	t.Helper()
+	return captureTee(t, os.Stderr, f)
+}
+
+// CaptureStdoutWithTimeout captures the output of a function that writes to stdout.
+// If f doesn't return within the given duration, stdout is restored and the test fails.
+// The goroutine running f can't be stopped and is left behind in this case,
+// it is racing with the restored stdout if it keeps writing to it.
+func CaptureStdoutWithTimeout(t *testing.T, d time.Duration, f func()) string {
+	t.Helper()
+	out, err := captureTimeout(t, os.Stdout, d, f)
 	if err != nil {
 		t.Fatal(err)
 	}
-	rErr, wErr, err := os.Pipe()
+	return out
+}
+
+// CaptureStderrWithTimeout captures the output of a function that writes to stderr.
+// If f doesn't return within the given duration, stderr is restored and the test fails.
+func CaptureStderrWithTimeout(t *testing.T, d time.Duration, f func()) string {
+	t.Helper()
+	out, err := captureTimeout(t, os.Stderr, d, f)
 	if err != nil {
 		t.Fatal(err)
 	}
-	os.Stdout, os.Stderr = wOut, wErr
+	return out
+}
+
+// redirect describes files redirected to dst during capture.
+// All files share a single pipe, so the order of writes to them is preserved.
+type redirect struct {
+	files []*os.File
+	dst   io.Writer
+}
+
+// capturedPanic is a panic recovered from the captured function.
+type capturedPanic struct {
+	value any
+	stack []byte
+}
+
+// captureTo redirects files to their destinations while f is running. The files are restored
+// and all the output is copied to destinations even if f panics or calls t.FailNow.
+// The panic is returned to the caller.
+func captureTo(t *testing.T, f func(), redirects ...redirect) *capturedPanic {
+	type saved struct {
+		file *os.File
+		old  os.File
+	}
+	var restore []saved
+	var waits []func()
 	defer func() {
-		os.Stdout, os.Stderr = oldout, olderr
+		for _, s := range restore {
+			*s.file = s.old
+		}
+		for _, wait := range waits {
+			wait()
+		}
 	}()
-	outCh, errCh := make(chan string), make(chan string)
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	for _, r := range redirects {
+		w, wait := pipeTo(t, r.dst)
+		waits = append(waits, wait)
+		for _, file := range r.files {
+			restore = append(restore, saved{file: file, old: *file})
+			// replace the file value rather than the variable, to capture writes through copies of the pointer
+			*file = *w
+		}
+	}
+	return catchPanic(f)
+}
 
+// pipeTo creates a pipe and copies everything written to it into dst in background.
+// The returned wait function closes the write end and waits for the copy to finish.
+func pipeTo(t *testing.T, dst io.Writer) (w *os.File, wait func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
 	go func() {
-		var buf bytes.Buffer
-		wg.Done()
-		if _, err := io.Copy(&buf, rOut); err != nil {
-			t.Fatal(err)
+		defer close(done)
+		if _, err := io.Copy(dst, r); err != nil {
+			t.Error(err)
 		}
-		outCh <- buf.String()
 	}()
+	return w, func() {
+		w.Close()
+		<-done
+		r.Close()
+	}
+}
 
-	go func() {
-		var buf bytes.Buffer
-		wg.Done()
-		if _, err := io.Copy(&buf, rErr); err != nil {
-			t.Fatal(err)
+// catchPanic runs f and returns recovered panic, if any.
+func catchPanic(f func()) (p *capturedPanic) {
+	defer func() {
+		if r := recover(); r != nil {
+			if cp, ok := r.(*capturedPanic); ok {
+				p = cp // already recovered in another goroutine, keep the original stack
+				return
+			}
+			p = &capturedPanic{value: r, stack: debug.Stack()}
 		}
-		errCh <- buf.String()
 	}()
-
-	wg.Wait()
 	f()
+	return nil
+}
 
-	if err := wOut.Close(); err != nil {
-		t.Fatal(err)
+// repanic re-raises the panic recovered from the captured function, if any.
+// The original stack and the output captured before the panic are logged, as they are lost otherwise.
+func repanic(t *testing.T, p *capturedPanic, out string) {
+	t.Helper()
+	if p == nil {
+		return
 	}
-	if err := wErr.Close(); err != nil {
-		t.Fatal(err)
+	t.Logf("panic in captured function: %v\n%s", p.value, p.stack)
+	if out != "" {
+		t.Logf("output captured before panic: %q", out)
 	}
+	panic(p.value)
+}
 
-	stdout, stderr := <-outCh, <-errCh
-	return stdout, stderr
+func captureRecover(t *testing.T, out *os.File, f func()) (string, any) {
+	var buf bytes.Buffer
+	if p := captureTo(t, f, redirect{files: []*os.File{out}, dst: &buf}); p != nil {
+		return buf.String(), p.value
+	}
+	return buf.String(), nil
+}
+
+// captureTimeout captures output of f, returns error and output captured so far if f is not done in time.
+func captureTimeout(t *testing.T, out *os.File, d time.Duration, f func()) (string, error) {
+	var buf bytes.Buffer
+	var res error
+	p := captureTo(t, func() {
+		done := make(chan *capturedPanic, 1)
+		go func() { done <- catchPanic(f) }()
+		select {
+		case p := <-done:
+			if p != nil {
+				panic(p)
+			}
+		case <-time.After(d):
+			res = fmt.Errorf("function didn't return in %v", d)
+		}
+	}, redirect{files: []*os.File{out}, dst: &buf})
+	repanic(t, p, buf.String())
+	return buf.String(), res
+}
+
+func captureTee(t *testing.T, out *os.File, f func()) string {
+	var buf bytes.Buffer
+	old := *out
+	p := captureTo(t, f, redirect{files: []*os.File{out}, dst: io.MultiWriter(&buf, &old)})
+	repanic(t, p, buf.String())
+	return buf.String()
+}
+
+func captureN(t *testing.T, out *os.File, f func(), maxBytes int) (string, bool) {
+	buf := &limitedBuffer{max: maxBytes}
+	p := captureTo(t, f, redirect{files: []*os.File{out}, dst: buf})
+	repanic(t, p, buf.buf.String())
+	return buf.buf.String(), buf.truncated
+}
+
+func captureStream(t *testing.T, out *os.File, f func(), fn func(line string)) {
+	lw := &lineWriter{fn: fn}
+	p := captureTo(t, f, redirect{files: []*os.File{out}, dst: lw})
+	lw.Flush()
+	repanic(t, p, "")
+}
+
+func captureTailLines(t *testing.T, out *os.File, f func(), n int) []string {
+	var lines []string
+	lw := &lineWriter{fn: func(line string) {
+		if n <= 0 {
+			return
+		}
+		if len(lines) == n {
+			copy(lines, lines[1:])
+			lines = lines[:n-1]
+		}
+		lines = append(lines, line)
+	}}
+	p := captureTo(t, f, redirect{files: []*os.File{out}, dst: lw})
+	lw.Flush()
+	repanic(t, p, strings.Join(lines, "\n"))
+	return lines
 }
 
 func capture(t *testing.T, out *os.File, f func()) string {
-	old := out
-	r, w, err := os.Pipe()
-	if err != nil {
-		t.Fatal(err)
+	var buf bytes.Buffer
+	p := captureTo(t, f, redirect{files: []*os.File{out}, dst: &buf})
+	repanic(t, p, buf.String())
+	return buf.String()
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// limitedBuffer keeps up to max bytes and silently discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if left := b.max - b.buf.Len(); len(p) > left {
+		b.truncated = true
+		if left > 0 {
+			b.buf.Write(p[:left])
+		}
+		return len(p), nil
 	}
-	*out = *w
-	defer func() { *out = *old }()
+	return b.buf.Write(p)
+}
 
-	f()
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	buf []byte
+	max int
+}
 
-	w.Close()
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= b.max {
+		b.buf = append(b.buf[:0], p[n-max(b.max, 0):]...)
+		return n, nil
+	}
+	if drop := len(b.buf) + n - b.max; drop > 0 {
+		b.buf = append(b.buf[:0], b.buf[drop:]...)
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
 
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, r)
-	if err != nil {
-		t.Fatal(err)
+func (b *tailBuffer) String() string { return string(b.buf) }
+
+// lineWriter calls fn for each complete line written to it, without the trailing newline.
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
 	}
+}
 
-	return buf.String()
+// Flush passes the last incomplete line to fn.
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
 }
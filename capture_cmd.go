@@ -0,0 +1,43 @@
+package testutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// CommandResult is the result of a command run by CaptureCommand.
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+}
+
+// CaptureCommand runs the command and captures its stdout, stderr, exit code and duration.
+// Non-zero exit code is not a failure, it is reported in the result. The test fails if the command
+// can't be started or is killed because ctx is done.
+func CaptureCommand(t *testing.T, ctx context.Context, name string, args ...string) CommandResult {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second // don't hang on pipes held by orphaned child processes
+
+	st := time.Now()
+	err := cmd.Run()
+	res := CommandResult{Duration: time.Since(st), ExitCode: cmd.ProcessState.ExitCode()}
+	res.Stdout, res.Stderr = stdout.String(), stderr.String()
+
+	if err != nil && ctx.Err() != nil {
+		t.Fatalf("command %s not completed: %v", name, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("failed to run %s: %v", name, err)
+	}
+	return res
+}
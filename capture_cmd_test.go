@@ -0,0 +1,32 @@
+package testutils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCaptureCommand(t *testing.T) {
+	res := CaptureCommand(t, context.Background(), "sh", "-c", "echo out; echo err >&2; exit 3")
+	if res.Stdout != "out\n" {
+		t.Errorf("want stdout %q, got %q", "out\n", res.Stdout)
+	}
+	if res.Stderr != "err\n" {
+		t.Errorf("want stderr %q, got %q", "err\n", res.Stderr)
+	}
+	if res.ExitCode != 3 {
+		t.Errorf("want exit code 3, got %d", res.ExitCode)
+	}
+	if res.Duration <= 0 {
+		t.Errorf("want positive duration, got %v", res.Duration)
+	}
+}
+
+func TestCaptureCommandSuccess(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res := CaptureCommand(t, ctx, "echo", "hello", "world")
+	if res.Stdout != "hello world\n" || res.Stderr != "" || res.ExitCode != 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
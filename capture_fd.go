@@ -0,0 +1,43 @@
+//go:build unix
+
+package testutils
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// CaptureFD captures everything written to the file descriptor fd, usually 1 for stdout or 2 for stderr,
+// while f is running. Unlike other Capture functions, which replace os.Stdout and os.Stderr,
+// it redirects the descriptor itself with dup2, so writes made by cgo code and libraries bypassing
+// the os package are captured as well. Supported on unix systems only, the test is skipped elsewhere.
+func CaptureFD(t *testing.T, fd int, f func()) string {
+	t.Helper()
+	saved, err := unix.Dup(fd)
+	if err != nil {
+		t.Fatalf("failed to dup fd %d: %v", fd, err)
+	}
+
+	var buf bytes.Buffer
+	p := func() *capturedPanic {
+		w, wait := pipeTo(t, &buf)
+		if err := unix.Dup2(int(w.Fd()), fd); err != nil {
+			wait()
+			unix.Close(saved)
+			t.Fatalf("failed to redirect fd %d: %v", fd, err)
+		}
+		defer func() {
+			// restore the descriptor first, otherwise it keeps the pipe open and wait never ends
+			if err := unix.Dup2(saved, fd); err != nil {
+				t.Errorf("failed to restore fd %d: %v", fd, err)
+			}
+			unix.Close(saved)
+			wait()
+		}()
+		return catchPanic(f)
+	}()
+	repanic(t, p, buf.String())
+	return buf.String()
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package testutils
+
+import "testing"
+
+// CaptureFD captures everything written to the file descriptor fd. Descriptor-level capture is
+// supported on unix systems only, the test is skipped here.
+func CaptureFD(t *testing.T, _ int, _ func()) string {
+	t.Helper()
+	t.Skip("CaptureFD is not supported on this platform")
+	return ""
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package testutils
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestCaptureFD(t *testing.T) {
+	got := CaptureFD(t, 1, func() {
+		// write directly to the descriptor, bypassing os.Stdout
+		if _, err := syscall.Write(1, []byte("raw write\n")); err != nil {
+			t.Error(err)
+		}
+		fmt.Println("os.Stdout write")
+	})
+	if want := "raw write\nos.Stdout write\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	got = CaptureFD(t, 2, func() {
+		if _, err := syscall.Write(2, []byte("raw stderr")); err != nil {
+			t.Error(err)
+		}
+	})
+	if got != "raw stderr" {
+		t.Errorf("want %q, got %q", "raw stderr", got)
+	}
+}
@@ -0,0 +1,154 @@
+package testutils
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// LogRecord is a single log record captured by CaptureLog or CaptureSlog.
+type LogRecord struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   map[string]any // group attributes are flattened to dot-separated keys
+}
+
+// CaptureLog captures records written by f with the standard log package default logger.
+// Standard log has no levels, all records are reported with slog.LevelInfo,
+// and the message doesn't include the logger's prefix and flags.
+func CaptureLog(t *testing.T, f func()) []LogRecord {
+	t.Helper()
+	oldOut, oldFlags, oldPrefix := log.Writer(), log.Flags(), log.Prefix()
+	defer func() {
+		log.SetOutput(oldOut)
+		log.SetFlags(oldFlags)
+		log.SetPrefix(oldPrefix)
+	}()
+
+	store := &logStore{}
+	log.SetOutput(&logRecordWriter{store: store})
+	log.SetFlags(0)
+	log.SetPrefix("")
+
+	f()
+
+	return store.list()
+}
+
+// CaptureSlog captures records written by f with the slog default logger.
+// All levels are captured, including debug. As slog.SetDefault redirects the standard log package
+// to the new handler, records written with the standard log are captured as well.
+func CaptureSlog(t *testing.T, f func()) []LogRecord {
+	t.Helper()
+	oldLogger := slog.Default()
+	oldOut, oldFlags := log.Writer(), log.Flags()
+	defer func() {
+		slog.SetDefault(oldLogger)
+		// slog.SetDefault doesn't restore the standard logger if the old handler is the default one
+		log.SetOutput(oldOut)
+		log.SetFlags(oldFlags)
+	}()
+
+	store := &logStore{}
+	slog.SetDefault(slog.New(&captureHandler{store: store}))
+
+	f()
+
+	return store.list()
+}
+
+// logStore collects captured records, safe for concurrent use.
+type logStore struct {
+	mu      sync.Mutex
+	records []LogRecord
+}
+
+func (s *logStore) add(rec LogRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+}
+
+func (s *logStore) list() []LogRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]LogRecord(nil), s.records...)
+}
+
+// logRecordWriter makes a record from each write, log.Logger writes every message with a single call.
+type logRecordWriter struct {
+	store *logStore
+}
+
+func (w *logRecordWriter) Write(p []byte) (int, error) {
+	w.store.add(LogRecord{
+		Time:    time.Now(),
+		Level:   slog.LevelInfo,
+		Message: strings.TrimSuffix(string(p), "\n"),
+		Attrs:   map[string]any{},
+	})
+	return len(p), nil
+}
+
+// captureHandler is slog.Handler saving all records to the store.
+type captureHandler struct {
+	store  *logStore
+	attrs  []slog.Attr // attributes added with WithAttrs, keys already prefixed with groups
+	prefix string      // dot-separated groups added with WithGroup
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make(map[string]any, len(h.attrs)+r.NumAttrs())
+	for _, a := range h.attrs {
+		flattenAttr(attrs, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		flattenAttr(attrs, h.prefix, a)
+		return true
+	})
+	h.store.add(LogRecord{Time: r.Time, Level: r.Level, Message: r.Message, Attrs: attrs})
+	return nil
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := *h
+	res.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		res.attrs = append(res.attrs, a)
+	}
+	return &res
+}
+
+func (h *captureHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	res := *h
+	res.prefix = h.prefix + name + "."
+	return &res
+}
+
+// flattenAttr adds attribute to the map, group attributes are added with dot-separated keys.
+func flattenAttr(dst map[string]any, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		if a.Key != "" {
+			dst[prefix+a.Key] = v.Any()
+		}
+		return
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range v.Group() {
+		flattenAttr(dst, prefix, ga)
+	}
+}
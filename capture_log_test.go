@@ -0,0 +1,73 @@
+package testutils
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"testing"
+)
+
+func TestCaptureLog(t *testing.T) {
+	log.SetPrefix("[test] ")
+	defer log.SetPrefix("")
+
+	recs := CaptureLog(t, func() {
+		log.Printf("hello %s", "world")
+		log.Print("multi\nline")
+	})
+	if len(recs) != 2 {
+		t.Fatalf("want 2 records, got %d: %+v", len(recs), recs)
+	}
+	if recs[0].Message != "hello world" || recs[0].Level != slog.LevelInfo {
+		t.Errorf("unexpected record %+v", recs[0])
+	}
+	if recs[1].Message != "multi\nline" {
+		t.Errorf("unexpected record %+v", recs[1])
+	}
+	if log.Prefix() != "[test] " {
+		t.Errorf("log prefix not restored, got %q", log.Prefix())
+	}
+}
+
+func TestCaptureSlog(t *testing.T) {
+	oldOut, oldFlags := log.Writer(), log.Flags()
+
+	recs := CaptureSlog(t, func() {
+		slog.Debug("debug message", "k1", 1)
+		slog.With("service", "api").WithGroup("req").Warn("slow request", "path", "/ping",
+			slog.Group("timing", slog.Int("ms", 250)))
+		log.Print("std log")
+	})
+	if len(recs) != 3 {
+		t.Fatalf("want 3 records, got %d: %+v", len(recs), recs)
+	}
+
+	if recs[0].Level != slog.LevelDebug || recs[0].Message != "debug message" || recs[0].Attrs["k1"] != int64(1) {
+		t.Errorf("unexpected record %+v", recs[0])
+	}
+
+	wantAttrs := map[string]any{"service": "api", "req.path": "/ping", "req.timing.ms": int64(250)}
+	if recs[1].Level != slog.LevelWarn || recs[1].Message != "slow request" || len(recs[1].Attrs) != len(wantAttrs) {
+		t.Errorf("unexpected record %+v", recs[1])
+	}
+	for k, v := range wantAttrs {
+		if recs[1].Attrs[k] != v {
+			t.Errorf("attr %q: want %v, got %v", k, v, recs[1].Attrs[k])
+		}
+	}
+
+	if recs[2].Level != slog.LevelInfo || recs[2].Message != "std log" {
+		t.Errorf("unexpected record %+v", recs[2])
+	}
+
+	if log.Writer() != oldOut || log.Flags() != oldFlags {
+		t.Errorf("standard logger not restored")
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(oldOut)
+	slog.Info("after capture")
+	if !bytes.Contains(buf.Bytes(), []byte("after capture")) {
+		t.Errorf("slog default not restored, got %q", buf.String())
+	}
+}
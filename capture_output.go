@@ -0,0 +1,158 @@
+package testutils
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestingT is the subset of testing.TB used by assertion helpers to report failures.
+// *testing.T and *testing.B satisfy it.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// CapturedOutput is the captured output with assertion helpers. Failed assertions are reported
+// with t.Errorf, so the test continues, and return false.
+type CapturedOutput struct {
+	t   TestingT
+	out string
+}
+
+// CaptureStdoutResult captures the output of a function that writes to stdout
+// and returns it as CapturedOutput.
+func CaptureStdoutResult(t *testing.T, f func()) CapturedOutput {
+	t.Helper()
+	return CapturedOutput{t: t, out: CaptureStdout(t, f)}
+}
+
+// CaptureStderrResult captures the output of a function that writes to stderr
+// and returns it as CapturedOutput.
+func CaptureStderrResult(t *testing.T, f func()) CapturedOutput {
+	t.Helper()
+	return CapturedOutput{t: t, out: CaptureStderr(t, f)}
+}
+
+// CaptureCombinedResult captures the interleaved output of a function that writes to stdout and stderr
+// and returns it as CapturedOutput.
+func CaptureCombinedResult(t *testing.T, f func()) CapturedOutput {
+	t.Helper()
+	return CapturedOutput{t: t, out: CaptureCombined(t, f)}
+}
+
+// String returns the captured output as is.
+func (o CapturedOutput) String() string { return o.out }
+
+// Lines returns the captured output split by lines, without the trailing newline.
+func (o CapturedOutput) Lines() []string {
+	if o.out == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(o.out, "\n"), "\n")
+}
+
+// JSONLines returns each non-empty line of the captured output decoded as JSON object.
+// Lines which are not valid JSON objects are reported as errors and skipped.
+func (o CapturedOutput) JSONLines() []map[string]any {
+	o.t.Helper()
+	var res []map[string]any
+	for i, line := range o.Lines() {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			o.t.Errorf("line %d is not a JSON object: %v, %q", i+1, err, line)
+			continue
+		}
+		res = append(res, rec)
+	}
+	return res
+}
+
+// Contains checks the captured output contains substr.
+func (o CapturedOutput) Contains(substr string) bool {
+	o.t.Helper()
+	if !strings.Contains(o.out, substr) {
+		o.t.Errorf("output doesn't contain %q, got %q", substr, o.out)
+		return false
+	}
+	return true
+}
+
+// NotContains checks the captured output doesn't contain substr.
+func (o CapturedOutput) NotContains(substr string) bool {
+	o.t.Helper()
+	if strings.Contains(o.out, substr) {
+		o.t.Errorf("output contains %q, got %q", substr, o.out)
+		return false
+	}
+	return true
+}
+
+// MatchRegexp checks the captured output matches the regular expression.
+func (o CapturedOutput) MatchRegexp(expr string) bool {
+	o.t.Helper()
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		o.t.Errorf("invalid regexp %q: %v", expr, err)
+		return false
+	}
+	if !re.MatchString(o.out) {
+		o.t.Errorf("output doesn't match %q, got %q", expr, o.out)
+		return false
+	}
+	return true
+}
+
+// Empty checks nothing was captured.
+func (o CapturedOutput) Empty() bool {
+	o.t.Helper()
+	if o.out != "" {
+		o.t.Errorf("want empty output, got %q", o.out)
+		return false
+	}
+	return true
+}
+
+// JSONLogs is a list of JSON log records captured by CaptureJSONLogs.
+type JSONLogs []map[string]any
+
+// CaptureJSONLogs captures stdout and stderr of a function writing JSON logs and returns
+// each line decoded as a record. Lines which are not JSON objects are ignored.
+func CaptureJSONLogs(t *testing.T, f func()) JSONLogs {
+	t.Helper()
+	out := CapturedOutput{t: t, out: CaptureCombined(t, f)}
+	var res JSONLogs
+	for _, line := range out.Lines() {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || rec == nil {
+			continue
+		}
+		res = append(res, rec)
+	}
+	return res
+}
+
+// FilterByLevel returns records with the given level, taken from "level" field and compared case-insensitive.
+func (l JSONLogs) FilterByLevel(level string) JSONLogs {
+	var res JSONLogs
+	for _, rec := range l {
+		if v, ok := rec["level"].(string); ok && strings.EqualFold(v, level) {
+			res = append(res, rec)
+		}
+	}
+	return res
+}
+
+// FindByMsg returns the first record with the given message, taken from "msg" or "message" field.
+func (l JSONLogs) FindByMsg(msg string) (map[string]any, bool) {
+	for _, rec := range l {
+		if rec["msg"] == msg || rec["message"] == msg {
+			return rec, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,111 @@
+package testutils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// fakeT is TestingT recording reported failures, to test assertion helpers without failing the test.
+type fakeT struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+// Failed reports whether any failure was recorded.
+func (f *fakeT) Failed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.errors) > 0
+}
+
+func TestCaptureStdoutResult(t *testing.T) {
+	out := CaptureStdoutResult(t, func() {
+		fmt.Println("line 1")
+		fmt.Println("line 2")
+	})
+	if out.String() != "line 1\nline 2\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if lines := out.Lines(); len(lines) != 2 || lines[0] != "line 1" || lines[1] != "line 2" {
+		t.Errorf("unexpected lines %q", lines)
+	}
+	if !out.Contains("line 2") || !out.NotContains("line 3") || !out.MatchRegexp(`^line \d\n`) {
+		t.Error("assertion failed")
+	}
+}
+
+func TestCaptureStderrResult(t *testing.T) {
+	out := CaptureStderrResult(t, func() {
+		fmt.Fprintln(os.Stderr, `{"level":"info","msg":"started"}`)
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, `{"level":"error","msg":"failed","code":42}`)
+	})
+	recs := out.JSONLines()
+	if len(recs) != 2 {
+		t.Fatalf("want 2 records, got %d", len(recs))
+	}
+	if recs[0]["msg"] != "started" || recs[1]["code"] != float64(42) {
+		t.Errorf("unexpected records %v", recs)
+	}
+}
+
+func TestCaptureCombinedResult(t *testing.T) {
+	out := CaptureCombinedResult(t, func() {})
+	if !out.Empty() || out.Lines() != nil {
+		t.Errorf("want empty output, got %q", out.String())
+	}
+}
+
+func TestCapturedOutputFailures(t *testing.T) {
+	ft := &fakeT{}
+	out := CapturedOutput{t: ft, out: "some text\nnot json\n"}
+	if out.Contains("other") || out.NotContains("some") || out.MatchRegexp(`^\d+$`) || out.MatchRegexp(`(`) || out.Empty() {
+		t.Error("failed assertion should return false")
+	}
+	if recs := out.JSONLines(); len(recs) != 0 {
+		t.Errorf("want no records, got %v", recs)
+	}
+	if !ft.Failed() {
+		t.Error("failed assertion should be reported")
+	}
+}
+
+func TestCaptureJSONLogs(t *testing.T) {
+	logs := CaptureJSONLogs(t, func() {
+		fmt.Println(`{"level":"INFO","msg":"started","port":8080}`)
+		fmt.Println("plain text line")
+		fmt.Fprintln(os.Stderr, `{"level":"error","message":"failed"}`)
+		fmt.Println(`{"level":"info","msg":"ready"}`)
+	})
+	if len(logs) != 3 {
+		t.Fatalf("want 3 records, got %d: %v", len(logs), logs)
+	}
+
+	if info := logs.FilterByLevel("info"); len(info) != 2 {
+		t.Errorf("want 2 info records, got %v", info)
+	}
+	if debug := logs.FilterByLevel("debug"); len(debug) != 0 {
+		t.Errorf("want no debug records, got %v", debug)
+	}
+
+	rec, ok := logs.FindByMsg("started")
+	if !ok || rec["port"] != float64(8080) {
+		t.Errorf("unexpected record %v", rec)
+	}
+	if _, ok = logs.FindByMsg("failed"); !ok {
+		t.Error("record with message field not found")
+	}
+	if _, ok = logs.FindByMsg("unknown"); ok {
+		t.Error("unexpected record found")
+	}
+}
@@ -1,9 +1,14 @@
 package testutils
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCaptureStdout(t *testing.T) {
@@ -40,3 +45,360 @@ func TestCaptureStdoutAndStderr(t *testing.T) {
 		t.Errorf("want %q, got %q", wantErr, gotErr)
 	}
 }
+
+func TestCaptureOutput(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		i := i
+		t.Run(fmt.Sprintf("parallel-%d", i), func(t *testing.T) {
+			t.Parallel()
+			want := fmt.Sprintf("hello %d\n", i)
+			got := CaptureOutput(t, func(w io.Writer) {
+				fmt.Fprint(w, want)
+			})
+			if want != got {
+				t.Errorf("want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestCaptureOutputConcurrentWrites(t *testing.T) {
+	got := CaptureOutput(t, func(w io.Writer) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fmt.Fprintln(w, "line")
+			}()
+		}
+		wg.Wait()
+	})
+	if n := strings.Count(got, "line\n"); n != 10 {
+		t.Errorf("want 10 lines, got %d in %q", n, got)
+	}
+}
+
+func TestCaptureStdoutStream(t *testing.T) {
+	var lines []string
+	CaptureStdoutStream(t, func() {
+		fmt.Println("line 1")
+		fmt.Println("line 2")
+		fmt.Print("no newline")
+	}, func(line string) {
+		lines = append(lines, line)
+	})
+	want := []string{"line 1", "line 2", "no newline"}
+	if strings.Join(want, "|") != strings.Join(lines, "|") {
+		t.Errorf("want %q, got %q", want, lines)
+	}
+}
+
+func TestCaptureStderrStream(t *testing.T) {
+	progress := make(chan string, 10)
+	CaptureStderrStream(t, func() {
+		fmt.Fprintln(os.Stderr, "step 1")
+		if got := <-progress; got != "step 1" {
+			t.Errorf("want %q before next step, got %q", "step 1", got)
+		}
+		fmt.Fprintln(os.Stderr, "step 2")
+	}, func(line string) {
+		progress <- line
+	})
+	if got := <-progress; got != "step 2" {
+		t.Errorf("want %q, got %q", "step 2", got)
+	}
+}
+
+func TestCaptureStdoutN(t *testing.T) {
+	got, truncated := CaptureStdoutN(t, func() {
+		fmt.Print("hello world")
+	}, 5)
+	if got != "hello" || !truncated {
+		t.Errorf("want %q truncated, got %q, truncated=%v", "hello", got, truncated)
+	}
+
+	got, truncated = CaptureStdoutN(t, func() {
+		fmt.Print("hello")
+	}, 5)
+	if got != "hello" || truncated {
+		t.Errorf("want %q not truncated, got %q, truncated=%v", "hello", got, truncated)
+	}
+}
+
+func TestCaptureStderrN(t *testing.T) {
+	// more than the pipe buffer, make sure f doesn't block on write
+	big := strings.Repeat("x", 1024*1024)
+	got, truncated := CaptureStderrN(t, func() {
+		fmt.Fprint(os.Stderr, big)
+	}, 10)
+	if got != big[:10] || !truncated {
+		t.Errorf("want %q truncated, got %q, truncated=%v", big[:10], got, truncated)
+	}
+}
+
+func TestCaptureCombined(t *testing.T) {
+	got := CaptureCombined(t, func() {
+		fmt.Fprintln(os.Stdout, "out 1")
+		fmt.Fprintln(os.Stderr, "err 1")
+		fmt.Fprintln(os.Stdout, "out 2")
+		fmt.Fprintln(os.Stderr, "err 2")
+	})
+	want := "out 1\nerr 1\nout 2\nerr 2\n"
+	if want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestCaptureStdoutE(t *testing.T) {
+	out, err := CaptureStdoutE(t, func() error {
+		fmt.Print("some output")
+		return errors.New("failed")
+	})
+	if out != "some output" || err == nil || err.Error() != "failed" {
+		t.Errorf("unexpected result %q, %v", out, err)
+	}
+}
+
+func TestCaptureStderrE(t *testing.T) {
+	out, err := CaptureStderrE(t, func() error {
+		fmt.Fprint(os.Stderr, "some output")
+		return nil
+	})
+	if out != "some output" || err != nil {
+		t.Errorf("unexpected result %q, %v", out, err)
+	}
+}
+
+func TestCaptureStdoutAndStderrE(t *testing.T) {
+	o, e, err := CaptureStdoutAndStderrE(t, func() error {
+		fmt.Fprint(os.Stdout, "out")
+		fmt.Fprint(os.Stderr, "err")
+		return errors.New("failed")
+	})
+	if o != "out" || e != "err" || err == nil || err.Error() != "failed" {
+		t.Errorf("unexpected result %q, %q, %v", o, e, err)
+	}
+}
+
+func TestCaptureStdoutWithTimeout(t *testing.T) {
+	got := CaptureStdoutWithTimeout(t, time.Second, func() {
+		fmt.Print("hello world")
+	})
+	if got != "hello world" {
+		t.Errorf("want %q, got %q", "hello world", got)
+	}
+}
+
+func TestCaptureStderrWithTimeout(t *testing.T) {
+	got := CaptureStderrWithTimeout(t, time.Second, func() {
+		fmt.Fprint(os.Stderr, "hello world")
+	})
+	if got != "hello world" {
+		t.Errorf("want %q, got %q", "hello world", got)
+	}
+}
+
+func TestCaptureTimeoutExpired(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	oldStdout := *os.Stdout
+
+	got, err := captureTimeout(t, os.Stdout, 50*time.Millisecond, func() {
+		<-block
+	})
+	if err == nil {
+		t.Fatal("want timeout error")
+	}
+	if got != "" {
+		t.Errorf("want empty output, got %q", got)
+	}
+	if *os.Stdout != oldStdout {
+		t.Error("stdout not restored")
+	}
+}
+
+func TestCaptureStdoutTee(t *testing.T) {
+	var inner string
+	outer := CaptureStdout(t, func() {
+		inner = CaptureStdoutTee(t, func() {
+			fmt.Print("hello world")
+		})
+	})
+	if inner != "hello world" {
+		t.Errorf("want %q captured, got %q", "hello world", inner)
+	}
+	if outer != "hello world" {
+		t.Errorf("want %q copied to original stdout, got %q", "hello world", outer)
+	}
+}
+
+func TestCaptureStderrTee(t *testing.T) {
+	var inner string
+	outer := CaptureStderr(t, func() {
+		inner = CaptureStderrTee(t, func() {
+			fmt.Fprint(os.Stderr, "hello world")
+		})
+	})
+	if inner != "hello world" || outer != "hello world" {
+		t.Errorf("want %q captured and copied, got %q and %q", "hello world", inner, outer)
+	}
+}
+
+func TestCaptureFrom(t *testing.T) {
+	sink := os.Stdout
+	got := CaptureFrom(t, &sink, func() {
+		fmt.Fprint(sink, "to sink")
+	})
+	if got != "to sink" {
+		t.Errorf("want %q, got %q", "to sink", got)
+	}
+	if sink != os.Stdout {
+		t.Error("target not restored")
+	}
+
+	got = CaptureFrom(t, &os.Stderr, func() {
+		fmt.Fprint(os.Stderr, "to stderr")
+	})
+	if got != "to stderr" {
+		t.Errorf("want %q, got %q", "to stderr", got)
+	}
+}
+
+func TestCaptureStdoutRecover(t *testing.T) {
+	oldStdout := *os.Stdout
+	out, recovered := CaptureStdoutRecover(t, func() {
+		fmt.Print("before panic")
+		panic("boom")
+	})
+	if out != "before panic" || recovered != "boom" {
+		t.Errorf("unexpected result %q, %v", out, recovered)
+	}
+	if *os.Stdout != oldStdout {
+		t.Error("stdout not restored")
+	}
+
+	out, recovered = CaptureStdoutRecover(t, func() { fmt.Print("no panic") })
+	if out != "no panic" || recovered != nil {
+		t.Errorf("unexpected result %q, %v", out, recovered)
+	}
+}
+
+func TestCaptureStderrRecover(t *testing.T) {
+	out, recovered := CaptureStderrRecover(t, func() {
+		fmt.Fprint(os.Stderr, "before panic")
+		panic(errors.New("boom"))
+	})
+	if err, ok := recovered.(error); out != "before panic" || !ok || err.Error() != "boom" {
+		t.Errorf("unexpected result %q, %v", out, recovered)
+	}
+}
+
+func TestCaptureRepanic(t *testing.T) {
+	oldStdout, oldStderr := *os.Stdout, *os.Stderr
+	tbl := []struct {
+		name string
+		fn   func(t *testing.T, f func())
+	}{
+		{"stdout", func(t *testing.T, f func()) { CaptureStdout(t, f) }},
+		{"stdout and stderr", func(t *testing.T, f func()) { CaptureStdoutAndStderr(t, f) }},
+		{"combined", func(t *testing.T, f func()) { CaptureCombined(t, f) }},
+		{"from", func(t *testing.T, f func()) { CaptureFrom(t, &os.Stdout, f) }},
+		{"timeout", func(t *testing.T, f func()) { CaptureStdoutWithTimeout(t, time.Second, f) }},
+		{"stream", func(t *testing.T, f func()) { CaptureStdoutStream(t, f, func(string) {}) }},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != "boom" {
+					t.Errorf("want panic %q, got %v", "boom", r)
+				}
+				if *os.Stdout != oldStdout || *os.Stderr != oldStderr {
+					t.Error("streams not restored")
+				}
+			}()
+			tt.fn(t, func() {
+				fmt.Println("before panic")
+				panic("boom")
+			})
+		})
+	}
+}
+
+func TestCaptureStdoutLargeOutput(t *testing.T) {
+	big := strings.Repeat("x", 1024*1024)
+	got := CaptureStdout(t, func() {
+		fmt.Print(big)
+	})
+	if got != big {
+		t.Errorf("want %d bytes, got %d", len(big), len(got))
+	}
+}
+
+func TestCaptureStdoutTail(t *testing.T) {
+	got := CaptureStdoutTail(t, func() {
+		for i := 0; i < 1000; i++ {
+			fmt.Printf("line %03d\n", i)
+		}
+	}, 18)
+	if want := "line 998\nline 999\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	got = CaptureStdoutTail(t, func() { fmt.Print("short") }, 10)
+	if got != "short" {
+		t.Errorf("want %q, got %q", "short", got)
+	}
+}
+
+func TestCaptureStderrTail(t *testing.T) {
+	got := CaptureStderrTail(t, func() {
+		fmt.Fprint(os.Stderr, "0123456789")
+		fmt.Fprint(os.Stderr, "abc")
+	}, 5)
+	if got != "89abc" {
+		t.Errorf("want %q, got %q", "89abc", got)
+	}
+}
+
+func TestCaptureStdoutTailLines(t *testing.T) {
+	got := CaptureStdoutTailLines(t, func() {
+		for i := 0; i < 1000; i++ {
+			fmt.Printf("line %d\n", i)
+		}
+		fmt.Print("last")
+	}, 3)
+	if want := "line 998|line 999|last"; strings.Join(got, "|") != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestCaptureStderrTailLines(t *testing.T) {
+	got := CaptureStderrTailLines(t, func() {
+		fmt.Fprintln(os.Stderr, "one")
+	}, 3)
+	if len(got) != 1 || got[0] != "one" {
+		t.Errorf("want [one], got %q", got)
+	}
+}
+
+func TestCaptureDiscard(t *testing.T) {
+	got := CaptureCombined(t, func() {
+		CaptureDiscard(t, func() {
+			fmt.Println("to stdout")
+			fmt.Fprintln(os.Stderr, "to stderr")
+		})
+		fmt.Print("after discard")
+	})
+	if got != "after discard" {
+		t.Errorf("want %q, got %q", "after discard", got)
+	}
+}
+
+func BenchmarkCaptureDiscard(b *testing.B) {
+	CaptureDiscard(b, func() {
+		for i := 0; i < b.N; i++ {
+			fmt.Println("noisy output")
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package testutils
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// AssertFileEqual checks the content of the file equals want. Failures are reported with t.Errorf,
+// with a line diff for text content, and false is returned.
+func AssertFileEqual(t TestingT, path, want string) bool {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("can't read %s: %v", path, err)
+		return false
+	}
+	if diff := contentDiff([]byte(want), got); diff != "" {
+		t.Errorf("file %s content mismatch (-want +got):\n%s", path, diff)
+		return false
+	}
+	return true
+}
+
+// AssertFileContains checks the content of the file contains substr.
+func AssertFileContains(t TestingT, path, substr string) bool {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("can't read %s: %v", path, err)
+		return false
+	}
+	if !bytes.Contains(got, []byte(substr)) {
+		t.Errorf("file %s doesn't contain %q, got %q", path, substr, truncateString(string(got), 1024))
+		return false
+	}
+	return true
+}
+
+// AssertFilesIdentical checks files a and b have the same content.
+func AssertFilesIdentical(t TestingT, a, b string) bool {
+	t.Helper()
+	dataA, err := os.ReadFile(a)
+	if err != nil {
+		t.Errorf("can't read %s: %v", a, err)
+		return false
+	}
+	dataB, err := os.ReadFile(b)
+	if err != nil {
+		t.Errorf("can't read %s: %v", b, err)
+		return false
+	}
+	if diff := contentDiff(dataA, dataB); diff != "" {
+		t.Errorf("files %s and %s differ (-%s +%s):\n%s", a, b, filepath.Base(a), filepath.Base(b), diff)
+		return false
+	}
+	return true
+}
+
+// AssertDirEqual checks directories dirA and dirB have the same files, directories and file contents.
+// Missing and extra entries, as well as content differences, are reported all at once.
+func AssertDirEqual(t TestingT, dirA, dirB string) bool {
+	t.Helper()
+	entriesA, err := dirEntries(dirA)
+	if err != nil {
+		t.Errorf("can't read dir %s: %v", dirA, err)
+		return false
+	}
+	entriesB, err := dirEntries(dirB)
+	if err != nil {
+		t.Errorf("can't read dir %s: %v", dirB, err)
+		return false
+	}
+
+	var problems []string
+	for _, name := range sortedKeys(entriesA) {
+		isDirA := entriesA[name]
+		isDirB, ok := entriesB[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("only in %s: %s", dirA, name))
+		case isDirA != isDirB:
+			problems = append(problems, fmt.Sprintf("%s is a dir in one and a file in another", name))
+		case !isDirA:
+			a, errA := os.ReadFile(filepath.Join(dirA, name))
+			b, errB := os.ReadFile(filepath.Join(dirB, name))
+			if errA != nil || errB != nil {
+				problems = append(problems, fmt.Sprintf("can't read %s: %v, %v", name, errA, errB))
+				continue
+			}
+			if diff := contentDiff(a, b); diff != "" {
+				problems = append(problems, fmt.Sprintf("%s differs:\n%s", name, diff))
+			}
+		}
+	}
+	for _, name := range sortedKeys(entriesB) {
+		if _, ok := entriesA[name]; !ok {
+			problems = append(problems, fmt.Sprintf("only in %s: %s", dirB, name))
+		}
+	}
+
+	if len(problems) > 0 {
+		t.Errorf("dirs %s and %s differ:\n%s", dirA, dirB, strings.Join(problems, "\n"))
+		return false
+	}
+	return true
+}
+
+// dirEntries returns all entries of the directory tree with slash-separated relative paths,
+// mapped to the directory flag.
+func dirEntries(root string) (map[string]bool, error) {
+	res := map[string]bool{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		res[filepath.ToSlash(rel)] = d.IsDir()
+		return nil
+	})
+	return res, err
+}
+
+func sortedKeys(m map[string]bool) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// contentDiff returns a description of the difference between want and got, empty if they are equal.
+// Text content is compared by lines, binary content reports the first differing offset.
+func contentDiff(want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+	if !isText(want) || !isText(got) {
+		i := 0
+		for i < len(want) && i < len(got) && want[i] == got[i] {
+			i++
+		}
+		return fmt.Sprintf("binary content differs at offset %d, sizes %d and %d", i, len(want), len(got))
+	}
+	return lineDiff(strings.Split(string(want), "\n"), strings.Split(string(got), "\n"))
+}
+
+func isText(data []byte) bool {
+	return utf8.Valid(data) && !bytes.ContainsRune(data, 0)
+}
+
+// maxDiffLines limits the size of the table used to calculate line diff, larger inputs
+// are reported by the first differing line only.
+const maxDiffLines = 1000
+
+// lineDiff returns changed lines, prefixed with "-" for want and "+" for got, and line numbers.
+func lineDiff(want, got []string) string {
+	if len(want) > maxDiffLines || len(got) > maxDiffLines {
+		i := 0
+		for i < len(want) && i < len(got) && want[i] == got[i] {
+			i++
+		}
+		var wantLine, gotLine string
+		if i < len(want) {
+			wantLine = want[i]
+		}
+		if i < len(got) {
+			gotLine = got[i]
+		}
+		return fmt.Sprintf("first difference at line %d:\n-%d: %s\n+%d: %s", i+1, i+1, wantLine, i+1, gotLine)
+	}
+
+	// longest common subsequence table, lcs[i][j] is for want[i:] and got[j:]
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+				continue
+			}
+			lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			i++
+			j++
+		case i < len(want) && (j == len(got) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&sb, "-%d: %s\n", i+1, want[i])
+			i++
+		default:
+			fmt.Fprintf(&sb, "+%d: %s\n", j+1, got[j])
+			j++
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
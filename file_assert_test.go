@@ -0,0 +1,84 @@
+package testutils
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssertFileEqual(t *testing.T) {
+	path := WriteTestFileWith(t, "line 1\nline 2\nline 3\n")
+	if !AssertFileEqual(t, path, "line 1\nline 2\nline 3\n") {
+		t.Error("want equal")
+	}
+
+	ft := &fakeT{}
+	if AssertFileEqual(ft, path, "line 1\nchanged\nline 3\n") || !ft.Failed() {
+		t.Error("want mismatch reported")
+	}
+	ft = &fakeT{}
+	if AssertFileEqual(ft, filepath.Join(t.TempDir(), "missing"), "") || !ft.Failed() {
+		t.Error("want missing file reported")
+	}
+}
+
+func TestAssertFileContains(t *testing.T) {
+	path := WriteTestFileWith(t, "some config content")
+	if !AssertFileContains(t, path, "config") {
+		t.Error("want contains")
+	}
+	ft := &fakeT{}
+	if AssertFileContains(ft, path, "missing") || !ft.Failed() {
+		t.Error("want missing substring reported")
+	}
+}
+
+func TestAssertFilesIdentical(t *testing.T) {
+	a := WriteTestFileWith(t, "same content")
+	b := WriteTestFileWith(t, "same content")
+	c := WriteTestFileWith(t, "other content")
+	if !AssertFilesIdentical(t, a, b) {
+		t.Error("want identical")
+	}
+	ft := &fakeT{}
+	if AssertFilesIdentical(ft, a, c) || !ft.Failed() {
+		t.Error("want difference reported")
+	}
+}
+
+func TestAssertDirEqual(t *testing.T) {
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b", "empty/": ""}
+	dirA, dirB := WriteTestDir(t, files), WriteTestDir(t, files)
+	if !AssertDirEqual(t, dirA, dirB) {
+		t.Error("want equal dirs")
+	}
+
+	dirC := WriteTestDir(t, map[string]string{"a.txt": "changed", "sub/c.txt": "c", "empty/": ""})
+	ft := &fakeT{}
+	if AssertDirEqual(ft, dirA, dirC) || !ft.Failed() {
+		t.Error("want difference reported")
+	}
+}
+
+func TestContentDiff(t *testing.T) {
+	if diff := contentDiff([]byte("same"), []byte("same")); diff != "" {
+		t.Errorf("want no diff, got %q", diff)
+	}
+
+	diff := contentDiff([]byte("a\nb\nc\nd"), []byte("a\nx\nc\nd\ne"))
+	want := "-2: b\n+2: x\n+5: e"
+	if diff != want {
+		t.Errorf("want %q, got %q", want, diff)
+	}
+
+	diff = contentDiff([]byte{0, 1, 2, 3}, []byte{0, 1, 5})
+	if want = "binary content differs at offset 2, sizes 4 and 3"; diff != want {
+		t.Errorf("want %q, got %q", want, diff)
+	}
+
+	long := strings.Repeat("line\n", maxDiffLines+10)
+	diff = contentDiff([]byte(long+"end"), []byte(long+"other"))
+	if !strings.HasPrefix(diff, "first difference at line 1011:") {
+		t.Errorf("unexpected diff for long content %q", diff)
+	}
+}
@@ -0,0 +1,55 @@
+package testutils
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+// PermissionsEnforced reports if file permissions restrict access for the current process.
+// It is false on Windows, where unix permission bits are mostly ignored, and for root,
+// who can read and write files regardless of permissions. Tests of permission error paths
+// usually should be skipped if it returns false.
+func PermissionsEnforced() bool {
+	return runtime.GOOS != "windows" && os.Geteuid() != 0
+}
+
+// WriteReadOnlyFile creates a file with the given content and read-only 0o400 permissions and returns its path.
+// Write permission is restored on cleanup, before the file is removed.
+// Options are the same as for WriteTestFileWith, except WithMode.
+func WriteReadOnlyFile(t *testing.T, content string, opts ...FileOption) string {
+	t.Helper()
+	return writePermFile(t, content, 0o400, opts)
+}
+
+// WriteUnreadableFile creates a file with the given content and no permissions at all and returns its path.
+// Permissions are restored on cleanup, before the file is removed. On Windows the file stays readable,
+// see PermissionsEnforced.
+func WriteUnreadableFile(t *testing.T, content string, opts ...FileOption) string {
+	t.Helper()
+	return writePermFile(t, content, 0o000, opts)
+}
+
+// WriteNoExecDir creates a directory tree with files like WriteTestDir, then removes the exec (search) bit
+// from the root, so its entries can't be accessed. The permissions are restored on cleanup, before
+// the directory is removed. On Windows the permissions are not changed, see PermissionsEnforced.
+func WriteNoExecDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := WriteTestDir(t, files)
+	if runtime.GOOS == "windows" {
+		return dir
+	}
+	if err := os.Chmod(dir, 0o600); err != nil {
+		t.Fatalf("failed to set mode for %s: %v", dir, err)
+	}
+	// cleanup functions are called in reverse order, so this runs before the temp dir removal
+	t.Cleanup(func() { _ = os.Chmod(dir, 0o750) })
+	return dir
+}
+
+func writePermFile(t *testing.T, content string, mode os.FileMode, opts []FileOption) string {
+	t.Helper()
+	path := WriteTestFileWith(t, content, append(append([]FileOption(nil), opts...), WithMode(mode))...)
+	t.Cleanup(func() { _ = os.Chmod(path, 0o600) })
+	return path
+}
@@ -0,0 +1,77 @@
+package testutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteReadOnlyFile(t *testing.T) {
+	path := WriteReadOnlyFile(t, "content", WithName("ro.txt"))
+	AssertFileEqual(t, path, "content")
+	if runtime.GOOS == "windows" {
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o400 {
+		t.Errorf("want mode 0400, got %v", fi.Mode().Perm())
+	}
+	if !PermissionsEnforced() {
+		t.Skip("permissions are not enforced")
+	}
+	if err = os.WriteFile(path, []byte("changed"), 0o600); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("want permission error, got %v", err)
+	}
+}
+
+func TestWriteUnreadableFile(t *testing.T) {
+	path := WriteUnreadableFile(t, "secret")
+	if runtime.GOOS == "windows" {
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0 {
+		t.Errorf("want mode 0000, got %v", fi.Mode().Perm())
+	}
+	if !PermissionsEnforced() {
+		t.Skip("permissions are not enforced")
+	}
+	if _, err = os.ReadFile(path); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("want permission error, got %v", err)
+	}
+}
+
+func TestWriteNoExecDir(t *testing.T) {
+	var dir string
+	t.Run("create", func(t *testing.T) {
+		dir = WriteNoExecDir(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+		if runtime.GOOS == "windows" {
+			return
+		}
+		fi, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm()&0o111 != 0 {
+			t.Errorf("want no exec bits, got %v", fi.Mode().Perm())
+		}
+		if !PermissionsEnforced() {
+			return
+		}
+		if _, err = os.ReadFile(filepath.Join(dir, "a.txt")); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("want permission error, got %v", err)
+		}
+	})
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("want dir removed on cleanup, got %v", err)
+	}
+}
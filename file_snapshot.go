@@ -0,0 +1,110 @@
+package testutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// DirSnapshot is a manifest of a directory tree made by SnapshotDir,
+// keyed by slash-separated paths relative to the root.
+type DirSnapshot map[string]FileSnapshot
+
+// FileSnapshot describes a single entry of DirSnapshot. Size and SHA256 are set for regular files only.
+type FileSnapshot struct {
+	IsDir  bool
+	Mode   fs.FileMode
+	Size   int64
+	SHA256 string
+}
+
+// DirDiff is a difference between two snapshots, paths are sorted.
+type DirDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports if there is no difference.
+func (d DirDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// SnapshotDir makes a manifest of all files and directories in dir with their modes, sizes and hashes.
+// Take snapshots before and after the code under test and compare them with DiffDirSnapshots
+// to check exactly what was changed on disk.
+func SnapshotDir(t *testing.T, dir string) DirSnapshot {
+	t.Helper()
+	res := DirSnapshot{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		snap := FileSnapshot{IsDir: d.IsDir(), Mode: fi.Mode()}
+		if fi.Mode().IsRegular() {
+			snap.Size = fi.Size()
+			if snap.SHA256, err = fileSHA256(path); err != nil {
+				return err
+			}
+		}
+		res[filepath.ToSlash(rel)] = snap
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to snapshot %s: %v", dir, err)
+	}
+	return res
+}
+
+// DiffDirSnapshots returns entries added, removed and changed between before and after snapshots.
+// An entry is changed if its type, mode, size or content differs.
+func DiffDirSnapshots(before, after DirSnapshot) DirDiff {
+	var res DirDiff
+	for path, a := range before {
+		b, ok := after[path]
+		switch {
+		case !ok:
+			res.Removed = append(res.Removed, path)
+		case a != b:
+			res.Changed = append(res.Changed, path)
+		}
+	}
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			res.Added = append(res.Added, path)
+		}
+	}
+	sort.Strings(res.Added)
+	sort.Strings(res.Removed)
+	sort.Strings(res.Changed)
+	return res
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,57 @@
+package testutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotDir(t *testing.T) {
+	dir := WriteTestDir(t, map[string]string{"a.txt": "content a", "sub/b.txt": "b", "empty/": ""})
+	snap := SnapshotDir(t, dir)
+	if len(snap) != 4 {
+		t.Fatalf("want 4 entries, got %d: %v", len(snap), snap)
+	}
+	a := snap["a.txt"]
+	sum := sha256.Sum256([]byte("content a"))
+	if a.IsDir || a.Size != 9 || a.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected snapshot of a.txt %+v", a)
+	}
+	if !snap["sub"].IsDir || !snap["empty"].IsDir || snap["sub/b.txt"].Size != 1 {
+		t.Errorf("unexpected snapshot %+v", snap)
+	}
+}
+
+func TestDiffDirSnapshots(t *testing.T) {
+	dir := WriteTestDir(t, map[string]string{"keep.txt": "keep", "change.txt": "old", "remove.txt": "remove"})
+	before := SnapshotDir(t, dir)
+
+	if diff := DiffDirSnapshots(before, SnapshotDir(t, dir)); !diff.Empty() {
+		t.Errorf("want no changes, got %+v", diff)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "change.txt"), []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "remove.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "new"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new", "added.txt"), []byte("added"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffDirSnapshots(before, SnapshotDir(t, dir))
+	want := DirDiff{Added: []string{"new", "new/added.txt"}, Removed: []string{"remove.txt"}, Changed: []string{"change.txt"}}
+	if !reflect.DeepEqual(want, diff) {
+		t.Errorf("want %+v, got %+v", want, diff)
+	}
+	if diff.Empty() {
+		t.Error("want non-empty diff")
+	}
+}
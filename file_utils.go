@@ -0,0 +1,612 @@
+package testutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// WriteTestDir creates a temporary directory tree with the given files and returns the root directory.
+// Keys are slash-separated paths relative to the root, values are file contents. Keys ending with "/"
+// create empty directories. The directory is removed automatically when the test completes.
+func WriteTestDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := writeDir(root, files); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// WriteTestDirE is like WriteTestDir, but returns an error instead of failing the test,
+// so it can be used from TestMain and helpers without *testing.T. The directory is created
+// in the system temporary directory, the caller is responsible for removing it with os.RemoveAll.
+func WriteTestDirE(files map[string]string) (string, error) {
+	root, err := os.MkdirTemp("", "testdir-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	if err := writeDir(root, files); err != nil {
+		_ = os.RemoveAll(root)
+		return "", err
+	}
+	return root, nil
+}
+
+func writeDir(root string, files map[string]string) error {
+	for name, content := range files {
+		path, err := testDirPath(root, name)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0o750); err != nil {
+				return fmt.Errorf("failed to create dir %s: %w", name, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return fmt.Errorf("failed to create dir for %s: %w", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// NewTestFS builds an in-memory file system from the same map of slash-separated paths to contents
+// as used by WriteTestDir, for testing code accepting fs.FS without touching the disk.
+// The returned fstest.MapFS can be changed by the test directly.
+func NewTestFS(t *testing.T, files map[string]string) fstest.MapFS {
+	t.Helper()
+	res := fstest.MapFS{}
+	for name, content := range files {
+		if strings.HasSuffix(name, "/") {
+			name = strings.TrimSuffix(name, "/")
+			if !fs.ValidPath(name) {
+				t.Fatalf("invalid path %q", name)
+			}
+			res[name] = &fstest.MapFile{Mode: fs.ModeDir | 0o750}
+			continue
+		}
+		if !fs.ValidPath(name) {
+			t.Fatalf("invalid path %q", name)
+		}
+		res[name] = &fstest.MapFile{Data: []byte(content), Mode: 0o600}
+	}
+	return res
+}
+
+// FileOption sets an option for WriteTestFileWith.
+type FileOption func(o *fileOptions)
+
+type fileOptions struct {
+	name string
+	ext  string
+	mode os.FileMode
+	dir  string
+}
+
+// WithName sets the file name, it must be local to the directory. By default the name is random.
+func WithName(name string) FileOption {
+	return func(o *fileOptions) { o.name = name }
+}
+
+// WithExt sets the extension, e.g. ".yaml", for the randomly generated file name. Ignored with WithName.
+func WithExt(ext string) FileOption {
+	return func(o *fileOptions) { o.ext = ext }
+}
+
+// WithMode sets the file permissions, 0o600 by default. The mode is set explicitly, not affected by umask.
+func WithMode(mode os.FileMode) FileOption {
+	return func(o *fileOptions) { o.mode = mode }
+}
+
+// WithDir sets an existing directory to create the file in, instead of a new temporary one.
+func WithDir(dir string) FileOption {
+	return func(o *fileOptions) { o.dir = dir }
+}
+
+// WriteTestFile creates a file with the given content and a random name in a new temporary directory,
+// and returns its path. The file is removed automatically when the test completes.
+func WriteTestFile(t *testing.T, content string) string {
+	t.Helper()
+	return WriteTestFileWith(t, content)
+}
+
+// WriteTestFileWith creates a file with the given content and returns its path. By default the file
+// has a random name and 0o600 permissions, and is created in a new temporary directory. The file is removed
+// automatically when the test completes, including the one created in the directory set with WithDir.
+func WriteTestFileWith(t *testing.T, content string, opts ...FileOption) string {
+	t.Helper()
+	o := fileOptions{mode: 0o600}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dir := o.dir
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	path, err := writeFile(dir, content, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.dir != "" {
+		t.Cleanup(func() { _ = os.Remove(path) })
+	}
+	return path
+}
+
+// WriteTestFileE is like WriteTestFile, accepting the options of WriteTestFileWith, but returns an error instead of failing the test,
+// so it can be used from TestMain and helpers without *testing.T. Without WithDir the file is created
+// in the system temporary directory. The caller is responsible for removing the file.
+func WriteTestFileE(content string, opts ...FileOption) (string, error) {
+	o := fileOptions{mode: 0o600, dir: os.TempDir()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return writeFile(o.dir, content, o)
+}
+
+// writeFile creates a file in dir according to options, the file is removed if it can't be written.
+func writeFile(dir, content string, o fileOptions) (string, error) {
+	var f *os.File
+	var err error
+	if o.name != "" {
+		name, perr := testDirPath(dir, o.name)
+		if perr != nil {
+			return "", perr
+		}
+		f, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	} else {
+		f, err = os.CreateTemp(dir, "testfile-*"+o.ext)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	path := f.Name()
+
+	_, err = f.WriteString(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(path, o.mode)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// WriteTestFileTemplate renders text/template tmpl with data, writes the result to a file and returns its path.
+// Missing map keys are reported as errors, not rendered as "<no value>". Options are the same as for WriteTestFileWith.
+func WriteTestFileTemplate(t *testing.T, tmpl string, data any, opts ...FileOption) string {
+	t.Helper()
+	tt, err := template.New("fixture").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err = tt.Execute(&buf, data); err != nil {
+		t.Fatalf("failed to render template: %v", err)
+	}
+	return WriteTestFileWith(t, buf.String(), opts...)
+}
+
+// WriteTestJSON marshals v to JSON, writes it to a file with ".json" extension and returns its path.
+// Options are the same as for WriteTestFileWith.
+func WriteTestJSON(t *testing.T, v any, opts ...FileOption) string {
+	t.Helper()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal json: %v", err)
+	}
+	return WriteTestFileWith(t, string(data), append([]FileOption{WithExt(".json")}, opts...)...)
+}
+
+// WriteTestYAML marshals v to YAML, writes it to a file with ".yaml" extension and returns its path.
+// Options are the same as for WriteTestFileWith.
+func WriteTestYAML(t *testing.T, v any, opts ...FileOption) string {
+	t.Helper()
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal yaml: %v", err)
+	}
+	return WriteTestFileWith(t, string(data), append([]FileOption{WithExt(".yaml")}, opts...)...)
+}
+
+// WriteTestTOML marshals v to TOML, writes it to a file with ".toml" extension and returns its path.
+// Options are the same as for WriteTestFileWith.
+func WriteTestTOML(t *testing.T, v any, opts ...FileOption) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatalf("failed to marshal toml: %v", err)
+	}
+	return WriteTestFileWith(t, buf.String(), append([]FileOption{WithExt(".toml")}, opts...)...)
+}
+
+// CopyTestData recursively copies srcDir, usually a testdata directory, into a new temporary directory
+// and returns its path, so tests can modify the fixture files without changing the originals.
+// File permissions and symlinks are preserved. The copy is removed automatically when the test completes.
+func CopyTestData(t *testing.T, srcDir string) string {
+	t.Helper()
+	dst := t.TempDir()
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o750)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target)
+		default:
+			return fmt.Errorf("unsupported file type %v of %s", d.Type(), path)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to copy %s: %v", srcDir, err)
+	}
+	return dst
+}
+
+// WriteRandomFile creates a file of the given size with pseudo-random content and returns its path
+// and hex-encoded SHA-256 checksum. The content is generated from seed, so the same seed always
+// produces the same file. The file is removed automatically when the test completes.
+func WriteRandomFile(t *testing.T, size int64, seed int64) (path, sha256sum string) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "random-*")
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	rnd := rand.New(rand.NewSource(seed))
+	if _, err = io.CopyN(io.MultiWriter(f, h), rnd, size); err != nil {
+		t.Fatalf("failed to write random file: %v", err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatalf("failed to close random file: %v", err)
+	}
+	return f.Name(), hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateSparseFile creates a file of the given size without writing its content and returns its path.
+// On file systems supporting sparse files it takes almost no disk space, reading it returns zeros.
+// The file is removed automatically when the test completes.
+func CreateSparseFile(t *testing.T, size int64) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "sparse-*")
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer f.Close()
+	if err = f.Truncate(size); err != nil {
+		t.Fatalf("failed to set size of %s: %v", f.Name(), err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatalf("failed to close %s: %v", f.Name(), err)
+	}
+	return f.Name()
+}
+
+// CreateZeroFile creates a file of the given size filled with zeros and returns its path.
+// Unlike CreateSparseFile the content is actually written, so the disk space is allocated.
+// The file is removed automatically when the test completes.
+func CreateZeroFile(t *testing.T, size int64) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "zero-*")
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer f.Close()
+	if _, err = io.CopyN(f, zeroReader{}, size); err != nil {
+		t.Fatalf("failed to write %s: %v", f.Name(), err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatalf("failed to close %s: %v", f.Name(), err)
+	}
+	return f.Name()
+}
+
+// zeroReader is an endless source of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// ExtractTestArchive unpacks the archive, usually stored in testdata, into a new temporary directory
+// and returns its path. Supported formats are .tar, .tar.gz, .tgz and .zip, detected by extension.
+// Entries with paths escaping the directory, symlinks pointing outside of it and entries written
+// through symlinks fail the test. The directory is removed automatically
+// when the test completes.
+func ExtractTestArchive(t *testing.T, archive string) string {
+	t.Helper()
+	dst := t.TempDir()
+	var err error
+	switch name := strings.ToLower(archive); {
+	case strings.HasSuffix(name, ".zip"):
+		err = extractZip(archive, dst)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		err = extractTar(archive, dst, true)
+	case strings.HasSuffix(name, ".tar"):
+		err = extractTar(archive, dst, false)
+	default:
+		err = fmt.Errorf("unsupported archive format")
+	}
+	if err != nil {
+		t.Fatalf("failed to extract %s: %v", archive, err)
+	}
+	return dst
+}
+
+func extractTar(archive, dst string, gzipped bool) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var rd io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		rd = gz
+	}
+
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := testDirPath(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := checkNoSymlinks(dst, target); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o750); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			// pax global header, written by git archive with the commit id, has nothing to extract
+		case tar.TypeSymlink:
+			if err := checkSymlinkTarget(dst, target, hdr.Linkname); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry type %c of %s", hdr.Typeflag, hdr.Name)
+		}
+	}
+}
+
+func extractZip(archive, dst string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		target, err := testDirPath(dst, zf.Name)
+		if err != nil {
+			return err
+		}
+		if err := checkNoSymlinks(dst, target); err != nil {
+			return err
+		}
+		if zf.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o750); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(target, rc, zf.Mode().Perm())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchiveFile writes file extracted from archive, creating parent directories.
+func writeArchiveFile(path string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	if perm == 0 {
+		perm = 0o600
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkSymlinkTarget rejects symlink at path pointing to an absolute location or outside of root.
+func checkSymlinkTarget(root, path, link string) error {
+	if filepath.IsAbs(link) {
+		return fmt.Errorf("invalid symlink %s -> %s, absolute target", path, link)
+	}
+	rel, err := filepath.Rel(root, filepath.Join(filepath.Dir(path), link))
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("invalid symlink %s -> %s, target outside of the directory", path, link)
+	}
+
+	// the check above is lexical, ".." after an already extracted symlink is applied to the link
+	// destination, not to the link itself, and can escape the directory
+	cur, throughLink := filepath.Dir(path), false
+	for _, part := range strings.Split(filepath.FromSlash(link), string(filepath.Separator)) {
+		switch part {
+		case ".", "":
+			continue
+		case "..":
+			if throughLink {
+				return fmt.Errorf("invalid symlink %s -> %s, \"..\" after symlink in target", path, link)
+			}
+			cur = filepath.Dir(cur)
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		if fi, err := os.Lstat(cur); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			throughLink = true
+		}
+	}
+	return nil
+}
+
+// checkNoSymlinks rejects path if it or any of its parents inside root is an existing symlink,
+// so extracted entries can't be written through links created by earlier entries.
+func checkNoSymlinks(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	cur := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid path %s, writing through symlink %s", path, cur)
+		}
+	}
+	return nil
+}
+
+// copyFile copies regular file src to dst, keeping the permissions.
+func copyFile(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, fi.Mode().Perm())
+}
+
+// WriteTestCSV writes the header, if not empty, and rows to a file with ".csv" extension and returns its path.
+// Options are the same as for WriteTestFileWith.
+func WriteTestCSV(t *testing.T, header []string, rows [][]string, opts ...FileOption) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if len(header) > 0 {
+		if err := w.Write(header); err != nil {
+			t.Fatalf("failed to write csv header: %v", err)
+		}
+	}
+	if err := w.WriteAll(rows); err != nil {
+		t.Fatalf("failed to write csv rows: %v", err)
+	}
+	return WriteTestFileWith(t, buf.String(), append([]FileOption{WithExt(".csv")}, opts...)...)
+}
+
+// WriteTestJSONL marshals each record to JSON, writes them one per line to a file with ".jsonl" extension
+// and returns its path. Options are the same as for WriteTestFileWith.
+func WriteTestJSONL(t *testing.T, records []any, opts ...FileOption) string {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatalf("failed to marshal record %d: %v", i, err)
+		}
+	}
+	return WriteTestFileWith(t, buf.String(), append([]FileOption{WithExt(".jsonl")}, opts...)...)
+}
+
+// testDirPath returns the path of slash-separated name inside root, rejecting names escaping the root.
+func testDirPath(root, name string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(strings.TrimSuffix(name, "/"))) {
+		return "", fmt.Errorf("invalid path %q, must be relative and inside the directory", name)
+	}
+	return filepath.Join(root, filepath.FromSlash(name)), nil
+}
@@ -0,0 +1,616 @@
+package testutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+func TestWriteTestDir(t *testing.T) {
+	root := WriteTestDir(t, map[string]string{
+		"config.yaml":         "key: value",
+		"data/users.json":     `[{"id":1}]`,
+		"data/nested/a/b.txt": "deep",
+		"empty/":              "",
+	})
+
+	for name, want := range map[string]string{
+		"config.yaml":         "key: value",
+		"data/users.json":     `[{"id":1}]`,
+		"data/nested/a/b.txt": "deep",
+	} {
+		got, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: want %q, got %q", name, want, string(got))
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(root, "empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Error("want empty dir created")
+	}
+}
+
+func TestTestDirPath(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"../escape.txt", "a/../../escape.txt", "/abs/path", ""} {
+		if _, err := testDirPath(root, name); err == nil {
+			t.Errorf("want error for %q", name)
+		}
+	}
+	path, err := testDirPath(root, "a/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "a", "b.txt"); path != want {
+		t.Errorf("want %q, got %q", want, path)
+	}
+}
+
+func TestWriteTestFile(t *testing.T) {
+	path := WriteTestFile(t, "some content")
+	AssertFileEqual(t, path, "some content")
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+		t.Errorf("want 0600 permissions, got %v", fi.Mode().Perm())
+	}
+}
+
+func TestWriteTestFileWith(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		path := WriteTestFileWith(t, "content")
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "content" {
+			t.Errorf("want %q, got %q", "content", string(got))
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+			t.Errorf("want mode 0600, got %v", fi.Mode().Perm())
+		}
+	})
+
+	t.Run("name and mode", func(t *testing.T) {
+		path := WriteTestFileWith(t, "key: value", WithName("config.yaml"), WithMode(0o644))
+		if filepath.Base(path) != "config.yaml" {
+			t.Errorf("want config.yaml, got %s", path)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o644 {
+			t.Errorf("want mode 0644, got %v", fi.Mode().Perm())
+		}
+	})
+
+	t.Run("ext", func(t *testing.T) {
+		path := WriteTestFileWith(t, "{}", WithExt(".json"))
+		if filepath.Ext(path) != ".json" {
+			t.Errorf("want .json extension, got %s", path)
+		}
+	})
+
+	t.Run("dir", func(t *testing.T) {
+		dir := t.TempDir()
+		var path string
+		t.Run("write", func(t *testing.T) {
+			path = WriteTestFileWith(t, "content", WithDir(dir), WithName("file.txt"))
+			if path != filepath.Join(dir, "file.txt") {
+				t.Errorf("unexpected path %s", path)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("want file removed on cleanup, got %v", err)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("want dir kept, got %v", err)
+		}
+	})
+}
+
+type testConfig struct {
+	Name  string   `json:"name" yaml:"name" toml:"name"`
+	Port  int      `json:"port" yaml:"port" toml:"port"`
+	Hosts []string `json:"hosts" yaml:"hosts" toml:"hosts"`
+}
+
+func TestWriteTestJSON(t *testing.T) {
+	want := testConfig{Name: "svc", Port: 8080, Hosts: []string{"a", "b"}}
+	path := WriteTestJSON(t, want)
+	if filepath.Ext(path) != ".json" {
+		t.Errorf("want .json extension, got %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got testConfig
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	path = WriteTestJSON(t, want, WithName("config.json.tmpl"))
+	if filepath.Base(path) != "config.json.tmpl" {
+		t.Errorf("want name from options, got %s", path)
+	}
+}
+
+func TestWriteTestYAML(t *testing.T) {
+	want := testConfig{Name: "svc", Port: 8080, Hosts: []string{"a", "b"}}
+	path := WriteTestYAML(t, want)
+	if filepath.Ext(path) != ".yaml" {
+		t.Errorf("want .yaml extension, got %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got testConfig
+	if err = yaml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestWriteTestTOML(t *testing.T) {
+	want := testConfig{Name: "svc", Port: 8080, Hosts: []string{"a", "b"}}
+	path := WriteTestTOML(t, want)
+	if filepath.Ext(path) != ".toml" {
+		t.Errorf("want .toml extension, got %s", path)
+	}
+	var got testConfig
+	if _, err := toml.DecodeFile(path, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestCopyTestData(t *testing.T) {
+	src := WriteTestDir(t, map[string]string{
+		"a.txt":          "file a",
+		"sub/b.txt":      "file b",
+		"sub/deep/c.txt": "file c",
+		"empty/":         "",
+	})
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(filepath.Join(src, "a.txt"), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("a.txt", filepath.Join(src, "link.txt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := CopyTestData(t, src)
+	if dst == src {
+		t.Fatal("want a new directory")
+	}
+	for name, want := range map[string]string{"a.txt": "file a", "sub/b.txt": "file b", "sub/deep/c.txt": "file c"} {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: want %q, got %q", name, want, string(got))
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("want empty dir copied, got %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(filepath.Join(dst, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0o640 {
+			t.Errorf("want mode 0640, got %v", fi.Mode().Perm())
+		}
+		link, err := os.Readlink(filepath.Join(dst, "link.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link != "a.txt" {
+			t.Errorf("want symlink to a.txt, got %s", link)
+		}
+	}
+
+	// changes in the copy don't affect the source
+	if err := os.WriteFile(filepath.Join(dst, "a.txt"), []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(src, "a.txt")); string(got) != "file a" {
+		t.Errorf("source changed: %q", string(got))
+	}
+}
+
+func TestWriteRandomFile(t *testing.T) {
+	path1, sum1 := WriteRandomFile(t, 3*1024*1024+7, 42)
+	fi, err := os.Stat(path1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 3*1024*1024+7 {
+		t.Errorf("want size %d, got %d", 3*1024*1024+7, fi.Size())
+	}
+
+	data, err := os.ReadFile(path1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := sha256.Sum256(data); hex.EncodeToString(h[:]) != sum1 {
+		t.Errorf("checksum mismatch")
+	}
+
+	path2, sum2 := WriteRandomFile(t, 3*1024*1024+7, 42)
+	if path1 == path2 || sum1 != sum2 {
+		t.Errorf("want same content in a different file for the same seed")
+	}
+	if _, sum3 := WriteRandomFile(t, 3*1024*1024+7, 43); sum3 == sum1 {
+		t.Errorf("want different content for a different seed")
+	}
+}
+
+func TestExtractTestArchive(t *testing.T) {
+	files := map[string]string{"a.txt": "file a", "sub/b.txt": "file b"}
+	dir := t.TempDir()
+
+	// tar.gz
+	tgzPath := filepath.Join(dir, "fixture.tar.gz")
+	var tgz bytes.Buffer
+	gz := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(files[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tgzPath, tgz.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// zip
+	zipPath := filepath.Join(dir, "fixture.zip")
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(zipPath, zbuf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, archive := range []string{tgzPath, zipPath} {
+		t.Run(filepath.Base(archive), func(t *testing.T) {
+			root := ExtractTestArchive(t, archive)
+			AssertDirEqual(t, WriteTestDir(t, files), root)
+		})
+	}
+}
+
+func TestExtractTarRejectsEscapingPaths(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("evil")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := WriteTestFileWith(t, buf.String(), WithExt(".tar"))
+	if err := extractTar(archive, t.TempDir(), false); err == nil {
+		t.Error("want error for path escaping the directory")
+	}
+}
+
+func TestExtractTarRejectsEscapingSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	makeTar := func(t *testing.T, entries ...*tar.Header) string {
+		t.Helper()
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range entries {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Size > 0 {
+				if _, err := tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size))); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return WriteTestFileWith(t, buf.String(), WithExt(".tar"))
+	}
+
+	tbl := []struct {
+		name    string
+		entries []*tar.Header
+	}{
+		{"absolute target", []*tar.Header{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "link/evil.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+		}},
+		{"relative target escaping", []*tar.Header{
+			{Name: "sub/link", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+		}},
+		{"write through inside link", []*tar.Header{
+			{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+			{Name: "link/file.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+		}},
+		{"chain of links escaping", []*tar.Header{
+			{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "a/l1", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "l2", Typeflag: tar.TypeSymlink, Linkname: "a/l1/.."},
+		}},
+		{"overwrite link itself", []*tar.Header{
+			{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "file.txt"},
+			{Name: "link", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+		}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := makeTar(t, tt.entries...)
+			if err := extractTar(archive, t.TempDir(), false); err == nil {
+				t.Error("want error for symlink escaping the directory")
+			}
+		})
+	}
+	if entries, err := os.ReadDir(outside); err != nil || len(entries) != 0 {
+		t.Errorf("want nothing written outside, got %v, %v", entries, err)
+	}
+
+	t.Run("local symlink allowed", func(t *testing.T) {
+		archive := makeTar(t, &tar.Header{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+			&tar.Header{Name: "sub/link", Typeflag: tar.TypeSymlink, Linkname: "../file.txt"})
+		dst := t.TempDir()
+		if err := extractTar(archive, dst, false); err != nil {
+			t.Fatal(err)
+		}
+		AssertFileEqual(t, filepath.Join(dst, "sub", "link"), "xxxx")
+	})
+}
+
+func TestExtractTarGitArchive(t *testing.T) {
+	// git archive starts tarballs with pax global header holding the commit id
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	hdr := &tar.Header{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, Format: tar.FormatPAX,
+		PAXRecords: map[string]string{"comment": "4f6e1a0c9b8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f"}}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "repo/README.md", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("pax_global_header")) {
+		t.Fatal("want pax global header in the archive")
+	}
+
+	archive := WriteTestFileWith(t, buf.String(), WithExt(".tar"))
+	dir := ExtractTestArchive(t, archive)
+	AssertFileEqual(t, filepath.Join(dir, "repo", "README.md"), "hello")
+	if _, err := os.Stat(filepath.Join(dir, "pax_global_header")); err == nil {
+		t.Error("pax global header extracted as a file")
+	}
+}
+
+func TestWriteTestFileTemplate(t *testing.T) {
+	data := struct {
+		Port int
+		Dir  string
+	}{Port: 5432, Dir: "/tmp/data"}
+	path := WriteTestFileTemplate(t, "port: {{.Port}}\ndir: {{.Dir}}\n", data, WithExt(".yaml"))
+	if filepath.Ext(path) != ".yaml" {
+		t.Errorf("want .yaml extension, got %s", path)
+	}
+	AssertFileEqual(t, path, "port: 5432\ndir: /tmp/data\n")
+
+	path = WriteTestFileTemplate(t, "url: {{.host}}:{{.port}}", map[string]any{"host": "localhost", "port": 8080})
+	AssertFileEqual(t, path, "url: localhost:8080")
+}
+
+func TestWriteTestCSV(t *testing.T) {
+	path := WriteTestCSV(t, []string{"id", "name"}, [][]string{{"1", "alice"}, {"2", "bob, jr"}})
+	if filepath.Ext(path) != ".csv" {
+		t.Errorf("want .csv extension, got %s", path)
+	}
+	AssertFileEqual(t, path, "id,name\n1,alice\n2,\"bob, jr\"\n")
+
+	path = WriteTestCSV(t, nil, [][]string{{"1", "alice"}})
+	AssertFileEqual(t, path, "1,alice\n")
+}
+
+func TestWriteTestJSONL(t *testing.T) {
+	path := WriteTestJSONL(t, []any{
+		map[string]any{"id": 1, "name": "alice"},
+		struct {
+			ID int `json:"id"`
+		}{ID: 2},
+	})
+	if filepath.Ext(path) != ".jsonl" {
+		t.Errorf("want .jsonl extension, got %s", path)
+	}
+	AssertFileEqual(t, path, "{\"id\":1,\"name\":\"alice\"}\n{\"id\":2}\n")
+}
+
+func TestCreateSparseFile(t *testing.T) {
+	path := CreateSparseFile(t, 1<<30)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 1<<30 {
+		t.Errorf("want size %d, got %d", 1<<30, fi.Size())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 1024)
+	if _, err = f.ReadAt(buf, 1<<29); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, make([]byte, 1024)) {
+		t.Error("want zero content")
+	}
+}
+
+func TestCreateZeroFile(t *testing.T) {
+	path := CreateZeroFile(t, 100_000)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 100_000 || !bytes.Equal(data, make([]byte, 100_000)) {
+		t.Errorf("want 100000 zero bytes, got %d bytes", len(data))
+	}
+}
+
+func TestWriteTestDirE(t *testing.T) {
+	root, err := WriteTestDirE(map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	AssertFileEqual(t, filepath.Join(root, "a.txt"), "a")
+	AssertFileEqual(t, filepath.Join(root, "sub", "b.txt"), "b")
+
+	if _, err = WriteTestDirE(map[string]string{"../escape.txt": "x"}); err == nil {
+		t.Error("want error for path escaping the directory")
+	}
+}
+
+func TestWriteTestFileE(t *testing.T) {
+	path, err := WriteTestFileE("content", WithExt(".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	if filepath.Dir(path) != filepath.Clean(os.TempDir()) || filepath.Ext(path) != ".txt" {
+		t.Errorf("unexpected path %s", path)
+	}
+	AssertFileEqual(t, path, "content")
+
+	dir := t.TempDir()
+	path, err = WriteTestFileE("content", WithDir(dir), WithName("file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "file.txt") {
+		t.Errorf("unexpected path %s", path)
+	}
+	for _, name := range []string{"../escape.txt", filepath.Join(t.TempDir(), "abs.txt"), "sub/../../escape.txt"} {
+		if _, err = WriteTestFileE("content", WithDir(dir), WithName(name)); err == nil {
+			t.Errorf("want error for name %q escaping the directory", name)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt")); err == nil {
+		t.Error("file written outside the directory")
+	}
+	if _, err = WriteTestFileE("again", WithDir(dir), WithName("file.txt")); err == nil {
+		t.Error("want error for existing file")
+	}
+	AssertFileEqual(t, path, "content")
+}
+
+func TestNewTestFS(t *testing.T) {
+	fsys := NewTestFS(t, map[string]string{
+		"config.yaml":     "key: value",
+		"data/users.json": `[{"id":1}]`,
+		"empty/":          "",
+	})
+	if err := fstest.TestFS(fsys, "config.yaml", "data/users.json", "empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(fsys, "data/users.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[{"id":1}]` {
+		t.Errorf("unexpected content %q", string(data))
+	}
+	fi, err := fs.Stat(fsys, "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Error("want empty dir")
+	}
+}
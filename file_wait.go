@@ -0,0 +1,92 @@
+package testutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+)
+
+// fileWaitInterval is a polling interval for file wait helpers.
+const fileWaitInterval = 10 * time.Millisecond
+
+// WaitForFileExists waits for the file to be created, failing the test if it doesn't exist after timeout.
+func WaitForFileExists(t *testing.T, path string, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("can't check %s: %v", path, err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("file %s not created in %v", path, timeout)
+		}
+		time.Sleep(fileWaitInterval)
+	}
+}
+
+// WaitForFileChange waits for the file to be changed, failing the test if it is not changed after timeout.
+// The file state is taken when the function is called, so it should be called before triggering
+// the change, usually with the code under test started in a goroutine afterwards. Creation and removal
+// of the file, as well as change of its size, modification time or content, are detected.
+func WaitForFileChange(t *testing.T, path string, timeout time.Duration) {
+	t.Helper()
+	initial, err := readFileState(path)
+	if err != nil {
+		t.Fatalf("can't check %s: %v", path, err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(fileWaitInterval)
+		current, err := readFileState(path)
+		if err != nil {
+			t.Fatalf("can't check %s: %v", path, err)
+		}
+		if !current.equal(initial) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("file %s not changed in %v", path, timeout)
+		}
+	}
+}
+
+// fileState is a state of the file compared by WaitForFileChange.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+// equal compares states, modification times are compared as instants, ignoring location and monotonic clock.
+func (s fileState) equal(other fileState) bool {
+	return s.exists == other.exists && s.size == other.size && s.modTime.Equal(other.modTime) && s.sha256 == other.sha256
+}
+
+func readFileState(path string) (fileState, error) {
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileState{}, nil
+	}
+	if err != nil {
+		return fileState{}, err
+	}
+	res := fileState{exists: true, size: fi.Size(), modTime: fi.ModTime()}
+	if fi.Mode().IsRegular() {
+		// hash catches rewrites of the same size within the modification time granularity
+		res.sha256, err = fileSHA256(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return fileState{}, nil // removed after stat
+		}
+		if err != nil {
+			return fileState{}, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,87 @@
+package testutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForFileExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "async.txt")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(path, []byte("done"), 0o600)
+	}()
+	WaitForFileExists(t, path, 5*time.Second)
+	AssertFileContains(t, path, "done")
+
+	// existing file returns immediately
+	st := time.Now()
+	WaitForFileExists(t, path, time.Second)
+	if time.Since(st) > 500*time.Millisecond {
+		t.Error("want immediate return for existing file")
+	}
+}
+
+func TestWaitForFileChange(t *testing.T) {
+	path := WriteTestFileWith(t, "aaaa")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(50 * time.Millisecond)
+		// same size, modification time may not change with coarse granularity
+		_ = os.WriteFile(path, []byte("bbbb"), 0o600)
+	}()
+	WaitForFileChange(t, path, 5*time.Second)
+	<-done
+	AssertFileEqual(t, path, "bbbb")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.Remove(path)
+	}()
+	WaitForFileChange(t, path, 5*time.Second)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("want file removed, got %v", err)
+	}
+}
+
+func TestReadFileState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	st, err := readFileState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.exists {
+		t.Error("want not existing state")
+	}
+	if err = os.WriteFile(path, []byte("content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	st, err = readFileState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.exists || st.size != 7 || st.sha256 == "" {
+		t.Errorf("unexpected state %+v", st)
+	}
+}
+
+func TestFileStateEqual(t *testing.T) {
+	mt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	a := fileState{exists: true, size: 3, modTime: mt, sha256: "abc"}
+	if !a.equal(fileState{exists: true, size: 3, modTime: mt.In(time.FixedZone("X", 3600)), sha256: "abc"}) {
+		t.Error("want same instant in another location to be equal")
+	}
+	if a.equal(fileState{exists: true, size: 3, modTime: mt.Add(time.Nanosecond), sha256: "abc"}) {
+		t.Error("want different modification time to differ")
+	}
+	if a.equal(fileState{exists: true, size: 3, modTime: mt, sha256: "abd"}) {
+		t.Error("want different content to differ")
+	}
+	if !(fileState{}).equal(fileState{}) {
+		t.Error("want missing files to be equal")
+	}
+}
@@ -1,3 +1,13 @@
 module github.com/go-pkgz/testutils
 
-go 1.20
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/net v0.35.0
+	golang.org/x/sys v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.22.0 // indirect
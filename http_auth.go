@@ -0,0 +1,46 @@
+package testutils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequireBasicAuth wraps next to pass only requests with basic auth credentials user and pass.
+// Other requests get 401 Unauthorized with WWW-Authenticate header and the reason in the body,
+// "missing credentials" or "invalid credentials", visible in RoundTripCaptor records of the client.
+func RequireBasicAuth(user, pass string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok {
+			authFailed(w, `Basic realm="test"`, "missing credentials")
+			return
+		}
+		if u != user || p != pass {
+			authFailed(w, `Basic realm="test"`, "invalid credentials")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireBearer wraps next to pass only requests with "Authorization: Bearer <token>" header.
+// Other requests get 401 Unauthorized, same way as RequireBasicAuth.
+func RequireBearer(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, got, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			authFailed(w, "Bearer", "missing credentials")
+			return
+		}
+		if got != token {
+			authFailed(w, `Bearer error="invalid_token"`, "invalid credentials")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func authFailed(w http.ResponseWriter, challenge, reason string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, reason, http.StatusUnauthorized)
+}
@@ -0,0 +1,69 @@
+package testutils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("ok")) })
+	basic := httptest.NewServer(RequireBasicAuth("user", "secret", ok))
+	defer basic.Close()
+	bearer := httptest.NewServer(RequireBearer("tkn", ok))
+	defer bearer.Close()
+
+	captor := CaptureRoundTripper(t, nil)
+	client := &http.Client{Transport: captor}
+
+	tbl := []struct {
+		name   string
+		url    string
+		setup  func(r *http.Request)
+		code   int
+		body   string
+		header string
+	}{
+		{"basic ok", basic.URL, func(r *http.Request) { r.SetBasicAuth("user", "secret") }, 200, "ok", ""},
+		{"basic missing", basic.URL, func(*http.Request) {}, 401, "missing credentials", `Basic realm="test"`},
+		{"basic wrong", basic.URL, func(r *http.Request) { r.SetBasicAuth("user", "bad") }, 401, "invalid credentials", `Basic realm="test"`},
+		{"bearer ok", bearer.URL, func(r *http.Request) { r.Header.Set("Authorization", "Bearer tkn") }, 200, "ok", ""},
+		{"bearer missing", bearer.URL, func(*http.Request) {}, 401, "missing credentials", "Bearer"},
+		{"bearer basic", bearer.URL, func(r *http.Request) { r.SetBasicAuth("user", "secret") }, 401, "missing credentials", "Bearer"},
+		{"bearer wrong", bearer.URL, func(r *http.Request) { r.Header.Set("Authorization", "Bearer bad") }, 401, "invalid credentials",
+			`Bearer error="invalid_token"`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, http.NoBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(req)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.code || strings.TrimSpace(string(body)) != tt.body {
+				t.Errorf("want %d %q, got %d %q", tt.code, tt.body, resp.StatusCode, body)
+			}
+			if got := resp.Header.Get("WWW-Authenticate"); got != tt.header {
+				t.Errorf("want WWW-Authenticate %q, got %q", tt.header, got)
+			}
+		})
+	}
+
+	failures := 0
+	for _, rec := range captor.Records() {
+		if rec.StatusCode == http.StatusUnauthorized {
+			failures++
+		}
+	}
+	if failures != 5 {
+		t.Errorf("want 5 auth failures captured, got %d", failures)
+	}
+}
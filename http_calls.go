@@ -0,0 +1,54 @@
+package testutils
+
+import (
+	"net/http"
+	"sync"
+)
+
+// CallCounter is an http.Handler counting requests by method and path before passing them
+// to the wrapped handler. Created by CountCalls, safe for concurrent use.
+type CallCounter struct {
+	next   http.Handler
+	mu     sync.Mutex
+	counts map[callKey]int
+}
+
+type callKey struct{ method, path string }
+
+// CountCalls wraps next to count served requests per route, to check with CallCount, AssertCalled
+// and AssertNotCalled which endpoints of a mock server the client hit. Routes are keyed by method and
+// URL path, query is ignored.
+func CountCalls(next http.Handler) *CallCounter {
+	return &CallCounter{next: next, counts: map[callKey]int{}}
+}
+
+// ServeHTTP counts the request and passes it to the wrapped handler.
+func (c *CallCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.counts[callKey{method: r.Method, path: r.URL.Path}]++
+	c.mu.Unlock()
+	c.next.ServeHTTP(w, r)
+}
+
+// CallCount returns number of requests served with the method and path.
+func (c *CallCounter) CallCount(method, path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[callKey{method: method, path: path}]
+}
+
+// AssertCalled fails the test if no request with the method and path was served.
+func (c *CallCounter) AssertCalled(t TestingT, method, path string) {
+	t.Helper()
+	if c.CallCount(method, path) == 0 {
+		t.Errorf("%s %s was not called", method, path)
+	}
+}
+
+// AssertNotCalled fails the test if any request with the method and path was served.
+func (c *CallCounter) AssertNotCalled(t TestingT, method, path string) {
+	t.Helper()
+	if n := c.CallCount(method, path); n > 0 {
+		t.Errorf("%s %s was called %d times, want none", method, path, n)
+	}
+}
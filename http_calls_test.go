@@ -0,0 +1,55 @@
+package testutils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountCalls(t *testing.T) {
+	counter := CountCalls(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ts := httptest.NewServer(counter)
+	defer ts.Close()
+
+	for _, u := range []string{"/users", "/users?page=2", "/health"} {
+		resp, err := http.Get(ts.URL + u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("want response of wrapped handler, got %d", resp.StatusCode)
+		}
+	}
+	resp, err := http.Post(ts.URL+"/users", "application/json", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if n := counter.CallCount("GET", "/users"); n != 2 {
+		t.Errorf("want 2 GET /users calls, got %d", n)
+	}
+	if n := counter.CallCount("POST", "/users"); n != 1 {
+		t.Errorf("want 1 POST /users call, got %d", n)
+	}
+	if n := counter.CallCount("DELETE", "/users"); n != 0 {
+		t.Errorf("want no DELETE /users calls, got %d", n)
+	}
+
+	counter.AssertCalled(t, "GET", "/health")
+	counter.AssertNotCalled(t, "GET", "/admin")
+
+	ft := &fakeT{}
+	counter.AssertCalled(ft, "GET", "/admin")
+	if !ft.Failed() {
+		t.Error("want failure for route not called")
+	}
+	ft = &fakeT{}
+	counter.AssertNotCalled(ft, "POST", "/users")
+	if !ft.Failed() {
+		t.Error("want failure for route called")
+	}
+}
@@ -0,0 +1,260 @@
+package testutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// CassetteMode defines if CassetteServer records or replays the exchanges.
+type CassetteMode int
+
+// Cassette modes, usually selected by the test from an environment variable or a flag.
+const (
+	// CassetteReplay serves responses from the cassette file without accessing the upstream.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord proxies requests to the upstream and saves the exchanges to the cassette file.
+	CassetteRecord
+)
+
+// CassetteServer starts a test server working as a recorder or a player of HTTP exchanges with upstream,
+// and returns its URL to be used instead of the upstream one by the code under test.
+//
+// In record mode requests are proxied to upstream and the exchanges are written to the cassette file,
+// usually in testdata, when the test completes. In replay mode the cassette file is loaded and requests
+// are answered with the recorded responses, matched by method, path with query and body. Repeated identical
+// requests get the recorded responses in order, the last one is reused after that. Unmatched requests fail
+// the test and get 501 Not Implemented. Request headers are not saved and values of cookies set by responses
+// are replaced with "REDACTED" in the file, so secrets don't leak to it, while the cookies themselves are kept
+// for session flows. Responses in record mode are passed as is. Responses are recorded decompressed.
+func CassetteServer(t *testing.T, path, upstream string, mode CassetteMode) string {
+	t.Helper()
+	c := &cassette{t: t, upstream: strings.TrimSuffix(upstream, "/")}
+	var h http.HandlerFunc
+	switch mode {
+	case CassetteRecord:
+		h = c.record
+		t.Cleanup(func() {
+			if err := c.save(path); err != nil {
+				t.Errorf("failed to save cassette %s: %v", path, err)
+			}
+		})
+	case CassetteReplay:
+		if err := c.load(path); err != nil {
+			t.Fatalf("failed to load cassette %s: %v", path, err)
+		}
+		h = c.replay
+	default:
+		t.Fatalf("unknown cassette mode %d", mode)
+	}
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// cassetteExchange is a recorded request and response, as stored in the cassette file.
+type cassetteExchange struct {
+	Request struct {
+		Method string       `json:"method"`
+		URI    string       `json:"uri"`
+		Body   cassetteBody `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status int          `json:"status"`
+		Header http.Header  `json:"header,omitempty"`
+		Body   cassetteBody `json:"body,omitempty"`
+	} `json:"response"`
+
+	used bool
+}
+
+// cassetteBody is stored as a string for text and as base64 for binary content.
+type cassetteBody []byte
+
+func (b cassetteBody) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *cassetteBody) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = []byte(s)
+		return nil
+	}
+	var enc struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	res, err := base64.StdEncoding.DecodeString(enc.Base64)
+	*b = res
+	return err
+}
+
+type cassette struct {
+	t        TestingT
+	upstream string
+
+	mu        sync.Mutex
+	exchanges []*cassetteExchange
+}
+
+func (c *cassette) record(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, c.upstream+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header = r.Header.Clone()
+	removeHopHeaders(req.Header)
+	// let the transport negotiate and decode compression, so bodies are stored readable
+	req.Header.Del("Accept-Encoding")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		c.t.Errorf("cassette upstream request %s %s failed: %v", r.Method, r.URL.RequestURI(), err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	ex := &cassetteExchange{}
+	ex.Request.Method, ex.Request.URI, ex.Request.Body = r.Method, r.URL.RequestURI(), body
+	ex.Response.Status, ex.Response.Header, ex.Response.Body = resp.StatusCode, resp.Header.Clone(), respBody
+	removeHopHeaders(ex.Response.Header)
+	ex.Response.Header.Del("Date")
+	saved := *ex
+	saved.Response.Header = redactSetCookie(ex.Response.Header)
+	c.mu.Lock()
+	c.exchanges = append(c.exchanges, &saved)
+	c.mu.Unlock()
+
+	writeCassetteResponse(w, ex)
+}
+
+func (c *cassette) replay(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	var match *cassetteExchange
+	for _, ex := range c.exchanges {
+		if ex.Request.Method != r.Method || ex.Request.URI != r.URL.RequestURI() || !bytes.Equal(ex.Request.Body, body) {
+			continue
+		}
+		match = ex
+		if !ex.used {
+			break
+		}
+	}
+	if match != nil {
+		match.used = true
+	}
+	c.mu.Unlock()
+
+	if match == nil {
+		c.t.Errorf("no recorded response for %s %s", r.Method, r.URL.RequestURI())
+		http.Error(w, fmt.Sprintf("no recorded response for %s %s", r.Method, r.URL.RequestURI()), http.StatusNotImplemented)
+		return
+	}
+	writeCassetteResponse(w, match)
+}
+
+// redactedValue replaces secrets in saved files.
+const redactedValue = "REDACTED"
+
+// redactSetCookie returns a copy of h with values of cookies in Set-Cookie headers replaced
+// by redactedValue, keeping cookie names and attributes.
+func redactSetCookie(h http.Header) http.Header {
+	res := h.Clone()
+	for i, v := range res.Values("Set-Cookie") {
+		name, rest, ok := strings.Cut(v, "=")
+		if !ok {
+			continue
+		}
+		redacted := name + "=" + redactedValue
+		if _, attrs, ok := strings.Cut(rest, ";"); ok {
+			redacted += ";" + attrs
+		}
+		res["Set-Cookie"][i] = redacted
+	}
+	return res
+}
+
+// hopHeaders are hop-by-hop headers, meaningful only for a single connection.
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// removeHopHeaders removes hop-by-hop headers, including ones listed in Connection header.
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+func writeCassetteResponse(w http.ResponseWriter, ex *cassetteExchange) {
+	for k, vv := range ex.Response.Header {
+		if k == "Content-Length" || k == "Transfer-Encoding" || k == "Connection" {
+			continue
+		}
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(ex.Response.Status)
+	_, _ = w.Write(ex.Response.Body)
+}
+
+func (c *cassette) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.exchanges)
+}
+
+func (c *cassette) save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c.exchanges, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
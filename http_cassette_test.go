@@ -0,0 +1,173 @@
+package testutils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCassetteServer(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/binary":
+			_, _ = w.Write([]byte{0xff, 0x00, 0xfe})
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			_, _ = fmt.Fprintf(w, "call %d %s %s %s", n, r.Method, r.URL.RequestURI(), body)
+		}
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "testdata", "api.json")
+	do := func(t *testing.T, base, method, uri, body string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, base+uri, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	var recorded []string
+	t.Run("record", func(t *testing.T) {
+		url := CassetteServer(t, path, upstream.URL, CassetteRecord)
+		for _, r := range [][3]string{
+			{"GET", "/items?page=1", ""}, {"GET", "/items?page=1", ""}, {"POST", "/items", `{"name":"x"}`},
+			{"GET", "/binary", ""}, {"GET", "/missing", ""},
+		} {
+			code, body := do(t, url, r[0], r[1], r[2])
+			recorded = append(recorded, fmt.Sprintf("%d %q", code, body))
+		}
+	})
+	if calls != 5 {
+		t.Fatalf("want 5 upstream calls in record mode, got %d", calls)
+	}
+	upstream.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		url := CassetteServer(t, path, "", CassetteReplay)
+		var replayed []string
+		for _, r := range [][3]string{
+			{"GET", "/items?page=1", ""}, {"GET", "/items?page=1", ""}, {"POST", "/items", `{"name":"x"}`},
+			{"GET", "/binary", ""}, {"GET", "/missing", ""},
+		} {
+			code, body := do(t, url, r[0], r[1], r[2])
+			replayed = append(replayed, fmt.Sprintf("%d %q", code, body))
+		}
+		if strings.Join(recorded, "\n") != strings.Join(replayed, "\n") {
+			t.Errorf("replayed responses differ\nrecorded:\n%s\nreplayed:\n%s", strings.Join(recorded, "\n"), strings.Join(replayed, "\n"))
+		}
+
+		// the last matching response is reused
+		if code, body := do(t, url, "GET", "/items?page=1", ""); code != 200 || !strings.HasPrefix(body, "call 2 ") {
+			t.Errorf("want the last recorded response, got %d %q", code, body)
+		}
+	})
+}
+
+func TestCassetteServerHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Hop") != "" || r.Header.Get("Keep-Alive") != "" {
+			t.Errorf("hop-by-hop headers forwarded: %v", r.Header)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("want credentials forwarded to upstream, got %v", r.Header)
+		}
+		w.Header().Set("Set-Cookie", "session=secret; Path=/")
+		w.Header().Set("X-Custom", "value")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write([]byte("compressible body"))
+			_ = gz.Close()
+			return
+		}
+		_, _ = w.Write([]byte("compressible body"))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "headers.json")
+	t.Run("record", func(t *testing.T) {
+		url := CassetteServer(t, path, upstream.URL, CassetteRecord)
+		req, err := http.NewRequest("GET", url+"/", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("Connection", "X-Hop")
+		req.Header.Set("X-Hop", "1")
+		req.Header.Set("Keep-Alive", "timeout=5")
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "compressible body" || resp.Header.Get("Set-Cookie") != "session=secret; Path=/" ||
+			resp.Header.Get("X-Custom") != "value" {
+			t.Errorf("unexpected recorded response %q %v", body, resp.Header)
+		}
+	})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret", "Content-Encoding", "base64"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q: %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), `"compressible body"`) || !strings.Contains(string(data), "X-Custom") ||
+		!strings.Contains(string(data), "session=REDACTED; Path=/") {
+		t.Errorf("want readable body, custom header and redacted cookie in cassette: %s", data)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		url := CassetteServer(t, path, upstream.URL, CassetteReplay)
+		resp, err := http.Get(url + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Header.Get("Set-Cookie") != "session=REDACTED; Path=/" {
+			t.Errorf("want redacted cookie in replay, got %v", resp.Header)
+		}
+	})
+}
+
+func TestCassetteReplayUnmatched(t *testing.T) {
+	path := WriteTestFileWith(t, `[]`, WithExt(".json"))
+	ft := &fakeT{}
+	c := &cassette{t: ft}
+	if err := c.load(path); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	c.replay(rec, httptest.NewRequest("GET", "/unknown", http.NoBody))
+	if rec.Code != http.StatusNotImplemented || !ft.Failed() {
+		t.Errorf("want 501 and failed test, got %d, failed=%v", rec.Code, ft.Failed())
+	}
+}
@@ -0,0 +1,142 @@
+package testutils
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ChaosConfig defines failures injected by ChaosHTTPServer. Rates are probabilities from 0 to 1.
+// Failures are drawn from a random source with the given seed, so the same sequence of requests
+// gets the same failures in every run.
+type ChaosConfig struct {
+	Seed            int64
+	Latency         time.Duration      // fixed delay before each response
+	Jitter          time.Duration      // random delay from 0 to Jitter added to Latency
+	ErrorRate       float64            // rate of responses with ErrorStatus instead of calling the handler
+	ErrorStatus     int                // status of injected errors, 500 by default
+	RouteErrorRates map[string]float64 // error rates by request path, override ErrorRate
+	ResetRate       float64            // rate of connections closed without any response
+	TruncateRate    float64            // rate of responses with the body cut in half and the connection closed
+	DropRate        float64            // rate of requests never answered, until the client gives up
+}
+
+// ChaosHTTPServer starts a test server passing requests to the handler with failures injected
+// according to cfg, and returns its URL. It is intended for testing retries, timeouts and other
+// resilience logic of clients. The server is closed automatically when the test completes.
+func ChaosHTTPServer(t *testing.T, h http.Handler, cfg ChaosConfig) string {
+	t.Helper()
+	if cfg.ErrorStatus == 0 {
+		cfg.ErrorStatus = http.StatusInternalServerError
+	}
+	ch := &chaosHandler{next: h, cfg: cfg, rnd: rand.New(rand.NewSource(cfg.Seed)), stop: make(chan struct{})}
+	ts := httptest.NewServer(ch)
+	t.Cleanup(ts.Close)
+	// release dropped requests before closing the server, cleanups run in reverse order
+	t.Cleanup(func() { close(ch.stop) })
+	return ts.URL
+}
+
+type chaosHandler struct {
+	next http.Handler
+	cfg  ChaosConfig
+	stop chan struct{}
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// chaosPlan is a set of failures drawn for a single request.
+type chaosPlan struct {
+	delay                       time.Duration
+	drop, reset, fail, truncate bool
+}
+
+func (c *chaosHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	plan := c.plan(r.URL.Path)
+
+	if plan.drop {
+		select {
+		case <-r.Context().Done():
+		case <-c.stop:
+		}
+		c.closeConn(w)
+		return
+	}
+
+	if plan.delay > 0 {
+		select {
+		case <-time.After(plan.delay):
+		case <-r.Context().Done():
+			return
+		case <-c.stop:
+			return
+		}
+	}
+
+	switch {
+	case plan.reset:
+		c.closeConn(w)
+	case plan.fail:
+		http.Error(w, http.StatusText(c.cfg.ErrorStatus), c.cfg.ErrorStatus)
+	case plan.truncate:
+		c.truncated(w, r)
+	default:
+		c.next.ServeHTTP(w, r)
+	}
+}
+
+// plan draws failures for the request, all values are drawn every time to keep the sequence stable.
+func (c *chaosHandler) plan(path string) chaosPlan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	errRate := c.cfg.ErrorRate
+	if rate, ok := c.cfg.RouteErrorRates[path]; ok {
+		errRate = rate
+	}
+	res := chaosPlan{delay: c.cfg.Latency}
+	jitter := c.rnd.Float64()
+	if c.cfg.Jitter > 0 {
+		res.delay += time.Duration(jitter * float64(c.cfg.Jitter))
+	}
+	res.drop = c.rnd.Float64() < c.cfg.DropRate
+	res.reset = c.rnd.Float64() < c.cfg.ResetRate
+	res.fail = c.rnd.Float64() < errRate
+	res.truncate = c.rnd.Float64() < c.cfg.TruncateRate
+	return res
+}
+
+// closeConn closes the underlying connection without writing anything.
+func (c *chaosHandler) closeConn(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	_ = conn.Close()
+}
+
+// truncated calls the handler and writes its response with the full Content-Length
+// but only half of the body, then closes the connection.
+func (c *chaosHandler) truncated(w http.ResponseWriter, r *http.Request) {
+	rec := httptest.NewRecorder()
+	c.next.ServeHTTP(rec, r)
+	body := rec.Body.Bytes()
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", rec.Code, http.StatusText(rec.Code))
+	hdr := rec.Header().Clone()
+	hdr.Set("Content-Length", fmt.Sprint(len(body)))
+	hdr.Set("Connection", "close")
+	_ = hdr.Write(buf)
+	_, _ = buf.WriteString("\r\n")
+	_, _ = buf.Write(body[:len(body)/2])
+	_ = buf.Flush()
+}
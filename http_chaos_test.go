@@ -0,0 +1,96 @@
+package testutils
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChaosHTTPServer(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 100))
+	})
+	get := func(t *testing.T, client *http.Client, url string) (int, string, error) {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), err
+	}
+
+	t.Run("no failures", func(t *testing.T) {
+		url := ChaosHTTPServer(t, okHandler, ChaosConfig{})
+		code, body, err := get(t, http.DefaultClient, url)
+		if err != nil || code != http.StatusOK || len(body) != 100 {
+			t.Errorf("unexpected response %d, %d bytes, %v", code, len(body), err)
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		url := ChaosHTTPServer(t, okHandler, ChaosConfig{Latency: 100 * time.Millisecond, Jitter: 50 * time.Millisecond})
+		st := time.Now()
+		if _, _, err := get(t, http.DefaultClient, url); err != nil {
+			t.Fatal(err)
+		}
+		if since := time.Since(st); since < 100*time.Millisecond {
+			t.Errorf("want at least 100ms delay, got %v", since)
+		}
+	})
+
+	t.Run("errors by route", func(t *testing.T) {
+		url := ChaosHTTPServer(t, okHandler, ChaosConfig{ErrorRate: 1, ErrorStatus: http.StatusBadGateway,
+			RouteErrorRates: map[string]float64{"/healthy": 0}})
+		if code, _, _ := get(t, http.DefaultClient, url+"/any"); code != http.StatusBadGateway {
+			t.Errorf("want 502, got %d", code)
+		}
+		if code, _, _ := get(t, http.DefaultClient, url+"/healthy"); code != http.StatusOK {
+			t.Errorf("want 200, got %d", code)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		url := ChaosHTTPServer(t, okHandler, ChaosConfig{ResetRate: 1})
+		if _, _, err := get(t, http.DefaultClient, url); err == nil {
+			t.Error("want connection error")
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		url := ChaosHTTPServer(t, okHandler, ChaosConfig{TruncateRate: 1})
+		code, body, err := get(t, http.DefaultClient, url)
+		if code != http.StatusOK || len(body) != 50 || err == nil {
+			t.Errorf("want truncated body with error, got %d, %d bytes, %v", code, len(body), err)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		url := ChaosHTTPServer(t, okHandler, ChaosConfig{DropRate: 1})
+		client := &http.Client{Timeout: 100 * time.Millisecond}
+		if _, _, err := get(t, client, url); err == nil {
+			t.Error("want timeout error")
+		}
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		statuses := func() []int {
+			url := ChaosHTTPServer(t, okHandler, ChaosConfig{Seed: 42, ErrorRate: 0.5})
+			var res []int
+			for i := 0; i < 20; i++ {
+				code, _, _ := get(t, http.DefaultClient, url)
+				res = append(res, code)
+			}
+			return res
+		}
+		first, second := statuses(), statuses()
+		for i := range first {
+			if first[i] != second[i] {
+				t.Fatalf("want same sequence for the same seed, got %v and %v", first, second)
+			}
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package testutils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// IssueCookies wraps next to set cookies on every response, like a login or session endpoint.
+// A nil next responds with 200 and empty body.
+func IssueCookies(next http.Handler, cookies ...*http.Cookie) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range cookies {
+			http.SetCookie(w, c)
+		}
+		if next != nil {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// AssertCookieSet checks the jar has a cookie with name to be sent to rawURL, and its value
+// satisfies the matcher. A nil matcher accepts any value.
+func AssertCookieSet(t TestingT, jar http.CookieJar, rawURL, name string, matcher func(value string) bool) {
+	t.Helper()
+	c, found, err := jarCookie(jar, rawURL, name)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if !found {
+		t.Errorf("cookie %q not set for %s", name, rawURL)
+		return
+	}
+	if matcher != nil && !matcher(c.Value) {
+		t.Errorf("cookie %q for %s has unexpected value %q", name, rawURL, c.Value)
+	}
+}
+
+// AssertCookieNotSet checks the jar has no cookie with name to be sent to rawURL, for example after logout.
+func AssertCookieNotSet(t TestingT, jar http.CookieJar, rawURL, name string) {
+	t.Helper()
+	c, found, err := jarCookie(jar, rawURL, name)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if found {
+		t.Errorf("cookie %q for %s is set to %q", name, rawURL, c.Value)
+	}
+}
+
+func jarCookie(jar http.CookieJar, rawURL, name string) (c *http.Cookie, found bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	for _, c := range jar.Cookies(u) {
+		if c.Name == name {
+			return c, true, nil
+		}
+	}
+	return nil, false, nil
+}
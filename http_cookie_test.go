@@ -0,0 +1,64 @@
+package testutils
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCookieHelpers(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/login", IssueCookies(nil, &http.Cookie{Name: "session", Value: "abc123", Path: "/"},
+		&http.Cookie{Name: "admin", Value: "1", Path: "/admin"}))
+	mux.Handle("/logout", IssueCookies(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("bye"))
+	}), &http.Cookie{Name: "session", Path: "/", MaxAge: -1}))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(ts.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	AssertCookieSet(t, jar, ts.URL, "session", nil)
+	AssertCookieSet(t, jar, ts.URL, "session", func(v string) bool { return strings.HasPrefix(v, "abc") })
+	AssertCookieSet(t, jar, ts.URL+"/admin/users", "admin", func(v string) bool { return v == "1" })
+	AssertCookieNotSet(t, jar, ts.URL, "admin")
+
+	ft := &fakeT{}
+	AssertCookieSet(ft, jar, ts.URL, "session", func(v string) bool { return v == "other" })
+	if !ft.Failed() {
+		t.Error("want failure for unmatched value")
+	}
+	ft = &fakeT{}
+	AssertCookieSet(ft, jar, ts.URL, "missing", nil)
+	if !ft.Failed() {
+		t.Error("want failure for missing cookie")
+	}
+	ft = &fakeT{}
+	AssertCookieNotSet(ft, jar, ts.URL, "session")
+	if !ft.Failed() {
+		t.Error("want failure for set cookie")
+	}
+	ft = &fakeT{}
+	AssertCookieSet(ft, jar, "://bad", "session", nil)
+	if !ft.Failed() {
+		t.Error("want failure for invalid url")
+	}
+
+	resp, err = client.Get(ts.URL + "/logout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	AssertCookieNotSet(t, jar, ts.URL, "session")
+}
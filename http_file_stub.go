@@ -0,0 +1,93 @@
+package testutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FileStub is a test server started by FileServerStub, serving a single file content.
+type FileStub struct {
+	URL string
+
+	mu      sync.Mutex
+	content []byte
+	modTime time.Time
+	etag    string
+	force   int
+}
+
+// FileServerStub starts a test server serving content on any path with full support of Range,
+// If-Range, ETag, If-None-Match, If-Match, If-Modified-Since and If-Unmodified-Since semantics,
+// and returns FileStub with its URL. ETag is derived from the content. Use it for testing download
+// resumption and caching clients. The server is closed automatically when the test completes.
+func FileServerStub(t *testing.T, content []byte, modTime time.Time) *FileStub {
+	t.Helper()
+	s := &FileStub{}
+	s.SetContent(content, modTime)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	s.URL = ts.URL
+	return s
+}
+
+// SetContent replaces served content and its modification time, changing ETag, to simulate
+// the file updated on the server.
+func (s *FileStub) SetContent(content []byte, modTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content, s.modTime = content, modTime
+	sum := sha256.Sum256(content)
+	s.etag = fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// ETag returns the current ETag of the content, quoted.
+func (s *FileStub) ETag() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.etag
+}
+
+// ForceStatus makes the server respond with the status regardless of request headers, 0 restores
+// normal behavior. http.StatusPartialContent serves the requested range ignoring If-Range,
+// or the first half of content if the request has no Range. http.StatusNotModified and
+// http.StatusPreconditionFailed respond with the status and validator headers only.
+// Other statuses respond with a plain error.
+func (s *FileStub) ForceStatus(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.force = code
+}
+
+// ServeHTTP serves the content, used by the test server.
+func (s *FileStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, modTime, etag, force := s.content, s.modTime, s.etag, s.force
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	switch force {
+	case 0:
+	case http.StatusPartialContent:
+		r = r.Clone(r.Context())
+		r.Header.Del("If-Range")
+		if r.Header.Get("Range") == "" && len(content) > 1 {
+			r.Header.Set("Range", fmt.Sprintf("bytes=0-%d", len(content)/2-1))
+		}
+	case http.StatusNotModified, http.StatusPreconditionFailed:
+		w.WriteHeader(force)
+		return
+	default:
+		http.Error(w, http.StatusText(force), force)
+		return
+	}
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(content))
+}
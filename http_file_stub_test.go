@@ -0,0 +1,98 @@
+package testutils
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFileServerStub(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	stub := FileServerStub(t, []byte("0123456789"), modTime)
+
+	get := func(t *testing.T, headers map[string]string) (int, http.Header, string) {
+		t.Helper()
+		req, err := http.NewRequest("GET", stub.URL+"/file.bin", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header, string(body)
+	}
+
+	etag := stub.ETag()
+	lastMod := modTime.Format(http.TimeFormat)
+	tbl := []struct {
+		name    string
+		headers map[string]string
+		code    int
+		body    string
+	}{
+		{"full", nil, 200, "0123456789"},
+		{"range", map[string]string{"Range": "bytes=2-4"}, 206, "234"},
+		{"open range", map[string]string{"Range": "bytes=7-"}, 206, "789"},
+		{"bad range", map[string]string{"Range": "bytes=20-30"}, 416, ""},
+		{"etag match", map[string]string{"If-None-Match": etag}, 304, ""},
+		{"etag mismatch", map[string]string{"If-None-Match": `"other"`}, 200, "0123456789"},
+		{"not modified", map[string]string{"If-Modified-Since": lastMod}, 304, ""},
+		{"modified", map[string]string{"If-Modified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)}, 200, "0123456789"},
+		{"if-match failed", map[string]string{"If-Match": `"other"`}, 412, ""},
+		{"if-range match", map[string]string{"Range": "bytes=0-1", "If-Range": etag}, 206, "01"},
+		{"if-range changed", map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`}, 200, "0123456789"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			code, hdr, body := get(t, tt.headers)
+			if code != tt.code {
+				t.Errorf("want status %d, got %d", tt.code, code)
+			}
+			if code != 416 && hdr.Get("ETag") != etag {
+				t.Errorf("want etag %s, got %s", etag, hdr.Get("ETag"))
+			}
+			if tt.body != "" && body != tt.body {
+				t.Errorf("want body %q, got %q", tt.body, body)
+			}
+		})
+	}
+
+	t.Run("forced", func(t *testing.T) {
+		defer stub.ForceStatus(0)
+		stub.ForceStatus(http.StatusPartialContent)
+		if code, hdr, body := get(t, nil); code != 206 || body != "01234" || hdr.Get("Content-Range") != "bytes 0-4/10" {
+			t.Errorf("unexpected forced partial %d %q %v", code, body, hdr)
+		}
+		if code, _, body := get(t, map[string]string{"Range": "bytes=5-", "If-Range": `"other"`}); code != 206 || body != "56789" {
+			t.Errorf("unexpected forced partial with stale If-Range %d %q", code, body)
+		}
+		stub.ForceStatus(http.StatusNotModified)
+		if code, _, body := get(t, nil); code != 304 || body != "" {
+			t.Errorf("unexpected forced not modified %d %q", code, body)
+		}
+		stub.ForceStatus(http.StatusPreconditionFailed)
+		if code, _, _ := get(t, map[string]string{"If-Match": etag}); code != 412 {
+			t.Errorf("want forced 412, got %d", code)
+		}
+	})
+
+	t.Run("content changed", func(t *testing.T) {
+		stub.SetContent([]byte("new content"), modTime.Add(time.Hour))
+		if stub.ETag() == etag {
+			t.Fatal("etag not changed")
+		}
+		if code, _, body := get(t, map[string]string{"If-None-Match": etag}); code != 200 || body != "new content" {
+			t.Errorf("want new content, got %d %q", code, body)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package testutils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// harLog is the subset of HAR 1.2 format used to export and import captured traffic.
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	} `json:"timings"`
+	Error string `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	QueryString []harNameVal `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	Content     struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+		Encoding string `json:"encoding,omitempty"`
+	} `json:"content"`
+	RedirectURL string `json:"redirectURL"`
+	HeadersSize int    `json:"headersSize"`
+	BodySize    int    `json:"bodySize"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ExportHAR writes all captured round trips to path in HAR 1.2 format, readable by browser devtools
+// and other HTTP tooling. Failed round trips are exported with status 0 and the error in "_error" field.
+// Binary response bodies are base64 encoded. Credentials are replaced with "REDACTED": values of
+// Authorization, Proxy-Authorization and Cookie request headers, request cookies and cookies set by responses.
+func (c *RoundTripCaptor) ExportHAR(path string) error {
+	var har harLog
+	har.Log.Version = "1.2"
+	har.Log.Creator.Name, har.Log.Creator.Version = "go-pkgz/testutils", "1.0"
+	har.Log.Entries = []harEntry{}
+	for _, rec := range c.Records() {
+		har.Log.Entries = append(har.Log.Entries, harFromRecord(rec))
+	}
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal HAR: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create HAR dir: %w", err)
+	}
+	if err = os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write HAR: %w", err)
+	}
+	return nil
+}
+
+func harFromRecord(rec RoundTripRecord) harEntry {
+	e := harEntry{StartedDateTime: rec.Time, Time: float64(rec.Duration) / float64(time.Millisecond)}
+	e.Timings.Wait = e.Time
+	req := rec.Request
+	e.Request = harRequest{Method: req.Method, URL: req.URL.String(), HTTPVersion: req.Proto,
+		Cookies: []harNameVal{}, Headers: harHeaders(redactRequestHeaders(req.Header)), QueryString: []harNameVal{},
+		HeadersSize: -1, BodySize: len(rec.ReqBody)}
+	if e.Request.HTTPVersion == "" {
+		e.Request.HTTPVersion = "HTTP/1.1"
+	}
+	for _, c := range req.Cookies() {
+		e.Request.Cookies = append(e.Request.Cookies, harNameVal{Name: c.Name, Value: redactedValue})
+	}
+	for k, vv := range req.URL.Query() {
+		for _, v := range vv {
+			e.Request.QueryString = append(e.Request.QueryString, harNameVal{Name: k, Value: v})
+		}
+	}
+	if len(rec.ReqBody) > 0 {
+		e.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(rec.ReqBody)}
+	}
+
+	e.Response = harResponse{Status: rec.StatusCode, StatusText: http.StatusText(rec.StatusCode), HTTPVersion: "HTTP/1.1",
+		Cookies: []harNameVal{}, Headers: harHeaders(redactSetCookie(rec.RespHeader)), HeadersSize: -1, BodySize: len(rec.RespBody)}
+	if rec.Err != nil {
+		e.Error, e.Response.BodySize = rec.Err.Error(), -1
+		return e
+	}
+	e.Response.RedirectURL = rec.RespHeader.Get("Location")
+	e.Response.Content.Size, e.Response.Content.MimeType = len(rec.RespBody), rec.RespHeader.Get("Content-Type")
+	if utf8.Valid(rec.RespBody) {
+		e.Response.Content.Text = string(rec.RespBody)
+	} else {
+		e.Response.Content.Text, e.Response.Content.Encoding = base64.StdEncoding.EncodeToString(rec.RespBody), "base64"
+	}
+	return e
+}
+
+// harSecretHeaders are request headers with credentials, their values are not exported.
+var harSecretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// redactRequestHeaders returns a copy of h with values of harSecretHeaders replaced by redactedValue.
+func redactRequestHeaders(h http.Header) http.Header {
+	res := h.Clone()
+	for _, k := range harSecretHeaders {
+		for i := range res[k] {
+			res[k][i] = redactedValue
+		}
+	}
+	return res
+}
+
+func harHeaders(h http.Header) []harNameVal {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := []harNameVal{}
+	for _, k := range keys {
+		for _, v := range h[k] {
+			res = append(res, harNameVal{Name: k, Value: v})
+		}
+	}
+	return res
+}
+
+// LoadHARServer starts a test server replaying responses from the HAR file at path, exported by
+// RoundTripCaptor.ExportHAR or by browser devtools, and returns its URL. Requests are matched by method,
+// path with query and body, same way as CassetteServer in replay mode; the host of recorded URLs is ignored.
+// Entries without a response, like failed requests, are skipped.
+func LoadHARServer(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read HAR %s: %v", path, err)
+	}
+	var har harLog
+	if err = json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("failed to parse HAR %s: %v", path, err)
+	}
+
+	c := &cassette{t: t}
+	for i, e := range har.Log.Entries {
+		if e.Response.Status == 0 {
+			continue
+		}
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			t.Fatalf("invalid url %q in HAR entry %d: %v", e.Request.URL, i, err)
+		}
+		ex := &cassetteExchange{}
+		ex.Request.Method, ex.Request.URI = e.Request.Method, u.RequestURI()
+		if e.Request.PostData != nil {
+			ex.Request.Body = []byte(e.Request.PostData.Text)
+		}
+		ex.Response.Status, ex.Response.Header = e.Response.Status, http.Header{}
+		for _, h := range e.Response.Headers {
+			// content is stored decoded, original encoding headers don't apply to it
+			if http.CanonicalHeaderKey(h.Name) == "Content-Encoding" {
+				continue
+			}
+			ex.Response.Header.Add(h.Name, h.Value)
+		}
+		ex.Response.Body = []byte(e.Response.Content.Text)
+		if e.Response.Content.Encoding == "base64" {
+			if ex.Response.Body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+				t.Fatalf("invalid base64 content in HAR entry %d: %v", i, err)
+			}
+		}
+		c.exchanges = append(c.exchanges, ex)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(c.replay))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
@@ -0,0 +1,187 @@
+package testutils
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoundTripCaptor_ExportHAR(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/bin":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte{0xff, 0x01})
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"got":"` + string(body) + `","q":"` + r.URL.Query().Get("q") + `"}`))
+		}
+	}))
+	defer ts.Close()
+
+	captor := CaptureRoundTripper(t, nil)
+	client := &http.Client{Transport: captor}
+	resp, err := client.Post(ts.URL+"/items?q=1", "text/plain", strings.NewReader("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp, err = client.Get(ts.URL + "/bin"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	failing := CaptureRoundTripper(t, roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}))
+	_, _ = (&http.Client{Transport: failing}).Get("http://example.com/down")
+
+	path := filepath.Join(t.TempDir(), "traffic.har")
+	if err = captor.ExportHAR(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har harLog
+	if err = json.Unmarshal(data, &har); err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("unexpected HAR: %s", data)
+	}
+	e := har.Log.Entries[0]
+	if e.Request.Method != "POST" || e.Request.PostData == nil || e.Request.PostData.Text != "abc" ||
+		e.Response.Status != 201 || e.Response.Content.Text != `{"got":"abc","q":"1"}` {
+		t.Errorf("unexpected first entry: %+v", e)
+	}
+	if e := har.Log.Entries[1]; e.Response.Content.Encoding != "base64" || e.Response.Content.Text != "/wE=" {
+		t.Errorf("want base64 binary content, got %+v", e.Response.Content)
+	}
+
+	failedPath := filepath.Join(t.TempDir(), "failed.har")
+	if err = failing.ExportHAR(failedPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(failedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"_error": "connection refused"`) || !strings.Contains(string(data), `"status": 0`) {
+		t.Errorf("want failed entry with error, got %s", data)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		ts.Close()
+		url := LoadHARServer(t, path)
+		resp, err := http.Post(url+"/items?q=1", "text/plain", strings.NewReader("abc"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 201 || string(body) != `{"got":"abc","q":"1"}` || resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected replayed response %d %q %v", resp.StatusCode, body, resp.Header)
+		}
+
+		if resp, err = http.Get(url + "/bin"); err != nil {
+			t.Fatal(err)
+		}
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "\xff\x01" {
+			t.Errorf("want decoded binary body, got %q", body)
+		}
+	})
+}
+
+func TestRoundTripCaptor_ExportHARRedacted(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret-session; HttpOnly")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	captor := CaptureRoundTripper(t, nil)
+	req, err := http.NewRequest("GET", ts.URL, http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Proxy-Authorization", "Basic secret-proxy")
+	req.Header.Set("Cookie", "sid=secret-cookie")
+	req.Header.Set("X-Request-Id", "42")
+	resp, err := (&http.Client{Transport: captor}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Set-Cookie") != "session=secret-session; HttpOnly" {
+		t.Errorf("want cookie passed to the client, got %v", resp.Header)
+	}
+
+	path := filepath.Join(t.TempDir(), "traffic.har")
+	if err = captor.ExportHAR(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("HAR contains credentials: %s", data)
+	}
+	var har harLog
+	if err = json.Unmarshal(data, &har); err != nil {
+		t.Fatal(err)
+	}
+	e := har.Log.Entries[0]
+	headers := map[string]string{}
+	for _, h := range e.Request.Headers {
+		headers[h.Name] = h.Value
+	}
+	for _, k := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+		if headers[k] != "REDACTED" {
+			t.Errorf("want %s redacted, got %q", k, headers[k])
+		}
+	}
+	if headers["X-Request-Id"] != "42" {
+		t.Errorf("want other headers kept, got %v", headers)
+	}
+	if len(e.Request.Cookies) != 1 || e.Request.Cookies[0] != (harNameVal{Name: "sid", Value: "REDACTED"}) {
+		t.Errorf("want redacted request cookie, got %v", e.Request.Cookies)
+	}
+	if !strings.Contains(string(data), `"session=REDACTED; HttpOnly"`) {
+		t.Errorf("want redacted response cookie, got %s", data)
+	}
+}
+
+func TestLoadHARServer_FailedEntriesSkipped(t *testing.T) {
+	path := WriteTestFileWith(t, `{"log":{"version":"1.2","entries":[
+		{"request":{"method":"GET","url":"http://example.com/down"},"response":{"status":0},"_error":"refused"},
+		{"request":{"method":"GET","url":"https://example.com/up?x=1"},"response":{"status":200,"content":{"text":"ok"}}}]}}`,
+		WithExt(".har"))
+	url := LoadHARServer(t, path)
+	resp, err := http.Get(url + "/up?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "ok" {
+		t.Errorf("unexpected response %d %q", resp.StatusCode, body)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,150 @@
+package testutils
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ProxyRequest is a request passed through ForwardProxy. For CONNECT tunnels Method is "CONNECT"
+// and URL is the tunnel target host:port, for plain proxying it is the absolute request URL.
+type ProxyRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Time   time.Time
+}
+
+// ForwardProxy is a forward HTTP proxy started by MockForwardProxy.
+type ForwardProxy struct {
+	URL string
+
+	mu       sync.Mutex
+	requests []ProxyRequest
+	tunnels  map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// MockForwardProxy starts a forward proxy supporting plain HTTP proxying and CONNECT tunnels,
+// capturing all requests passed through it. Set its URL with http.ProxyURL as Proxy of the client
+// transport to verify the client actually routes requests through the proxy.
+// The proxy and open tunnels are closed automatically when the test completes.
+func MockForwardProxy(t *testing.T) *ForwardProxy {
+	t.Helper()
+	p := &ForwardProxy{tunnels: map[net.Conn]struct{}{}}
+	ts := httptest.NewServer(p)
+	p.URL = ts.URL
+	t.Cleanup(func() {
+		ts.Close()
+		// hijacked tunnel connections are not closed by the server
+		p.mu.Lock()
+		p.closed = true
+		for conn := range p.tunnels {
+			_ = conn.Close()
+		}
+		p.mu.Unlock()
+		p.wg.Wait()
+	})
+	return p
+}
+
+// Requests returns all requests passed through the proxy, in order.
+func (p *ForwardProxy) Requests() []ProxyRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ProxyRequest(nil), p.requests...)
+}
+
+// ServeHTTP proxies the request, used by the test server.
+func (p *ForwardProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := ProxyRequest{Method: r.Method, URL: r.URL.String(), Header: r.Header.Clone(), Time: time.Now()}
+	if r.Method == http.MethodConnect {
+		rec.URL = r.Host
+	}
+	p.mu.Lock()
+	p.requests = append(p.requests, rec)
+	p.mu.Unlock()
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range []string{"Proxy-Connection", "Proxy-Authorization", "Connection", "Keep-Alive", "Te", "Trailer", "Upgrade"} {
+		out.Header.Del(h)
+	}
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (p *ForwardProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	dst, err := net.DialTimeout("tcp", r.Host, 5*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		_ = dst.Close()
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	src, _, err := hj.Hijack()
+	if err != nil {
+		_ = dst.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err = io.WriteString(src, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		_ = src.Close()
+		_ = dst.Close()
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		// the tunnel is established after the cleanup closed the others
+		p.mu.Unlock()
+		_ = src.Close()
+		_ = dst.Close()
+		return
+	}
+	p.tunnels[src], p.tunnels[dst] = struct{}{}, struct{}{}
+	p.wg.Add(2)
+	p.mu.Unlock()
+	pipe := func(to, from net.Conn) {
+		defer p.wg.Done()
+		_, _ = io.Copy(to, from)
+		// close both sides to release the opposite copy
+		_ = to.Close()
+		_ = from.Close()
+		p.mu.Lock()
+		delete(p.tunnels, to)
+		delete(p.tunnels, from)
+		p.mu.Unlock()
+	}
+	go pipe(dst, src)
+	go pipe(src, dst)
+}
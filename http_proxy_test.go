@@ -0,0 +1,94 @@
+package testutils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMockForwardProxy(t *testing.T) {
+	proxy := MockForwardProxy(t)
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Connection") != "" {
+			t.Error("proxy header passed to target")
+		}
+		_, _ = w.Write([]byte("plain " + r.URL.Path))
+	}))
+	defer target.Close()
+	tlsTarget := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tls " + r.URL.Path))
+	}))
+	defer tlsTarget.Close()
+
+	get := func(t *testing.T, client *http.Client, u string) string {
+		t.Helper()
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	plainClient := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	defer plainClient.CloseIdleConnections()
+	if body := get(t, plainClient, target.URL+"/items?id=1"); body != "plain /items" {
+		t.Errorf("unexpected plain response %q", body)
+	}
+
+	tlsTransport := tlsTarget.Client().Transport.(*http.Transport).Clone()
+	tlsTransport.Proxy = http.ProxyURL(proxyURL)
+	tlsClient := &http.Client{Transport: tlsTransport}
+	defer tlsClient.CloseIdleConnections()
+	if body := get(t, tlsClient, tlsTarget.URL+"/secure"); body != "tls /secure" {
+		t.Errorf("unexpected tls response %q", body)
+	}
+
+	reqs := proxy.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("want 2 proxied requests, got %+v", reqs)
+	}
+	if reqs[0].Method != "GET" || reqs[0].URL != target.URL+"/items?id=1" {
+		t.Errorf("unexpected plain request %+v", reqs[0])
+	}
+	if reqs[1].Method != "CONNECT" || reqs[1].URL != strings.TrimPrefix(tlsTarget.URL, "https://") {
+		t.Errorf("unexpected connect request %+v", reqs[1])
+	}
+}
+
+func TestMockForwardProxyErrors(t *testing.T) {
+	proxy := MockForwardProxy(t)
+
+	resp, err := http.Get(proxy.URL + "/direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("want 400 for non-proxy request, got %d", resp.StatusCode)
+	}
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	defer client.CloseIdleConnections()
+	resp, err = client.Get(ClosedPortURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("want 502 for unreachable target, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,224 @@
+package testutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RoundTripRecord is a single outbound request and its response captured by RoundTripCaptor.
+// Response fields are empty if the round trip failed, Err is set in this case.
+type RoundTripRecord struct {
+	Request    *http.Request // the original request, its body is already consumed, use ReqBody
+	ReqBody    []byte
+	StatusCode int
+	RespHeader http.Header
+	RespBody   []byte
+	Err        error
+	Time       time.Time
+	Duration   time.Duration
+}
+
+// RoundTripCaptor is http.RoundTripper recording all requests and responses passing through it
+// to the next RoundTripper. It is safe for concurrent use.
+type RoundTripCaptor struct {
+	next       http.RoundTripper
+	maxRecords int
+	filter     func(*http.Request) bool
+
+	mu      sync.Mutex
+	records []RoundTripRecord
+}
+
+// CaptorOption sets an option for CaptureRoundTripper.
+type CaptorOption func(c *RoundTripCaptor)
+
+// WithMaxRecords keeps only the last n records, dropping the oldest ones, so long-running tests
+// don't accumulate unbounded memory.
+func WithMaxRecords(n int) CaptorOption {
+	return func(c *RoundTripCaptor) { c.maxRecords = n }
+}
+
+// WithRequestFilter records only requests the filter returns true for, other requests pass
+// through unrecorded. Use it to exclude noise like health checks.
+func WithRequestFilter(filter func(r *http.Request) bool) CaptorOption {
+	return func(c *RoundTripCaptor) { c.filter = filter }
+}
+
+// CaptureRoundTripper returns RoundTripCaptor passing requests to next, http.DefaultTransport if nil.
+// Set it as Transport of the http.Client used by the code under test to observe all outbound requests
+// without routing them through a mock server. Response bodies are read completely before returning
+// the response, so streaming responses are not delivered until done.
+func CaptureRoundTripper(t *testing.T, next http.RoundTripper, opts ...CaptorOption) *RoundTripCaptor {
+	t.Helper()
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c := &RoundTripCaptor{next: next}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// RoundTrip passes the request to the next RoundTripper and records the request and response.
+func (c *RoundTripCaptor) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.filter != nil && !c.filter(req) {
+		return c.next.RoundTrip(req)
+	}
+	rec := RoundTripRecord{Request: req, Time: time.Now()}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		rec.ReqBody = body
+		// pass a copy, RoundTrip must not modify the original request
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := c.next.RoundTrip(req)
+	if err == nil {
+		rec.StatusCode, rec.RespHeader = resp.StatusCode, resp.Header.Clone()
+		rec.RespBody, err = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(rec.RespBody))
+		if err != nil {
+			resp = nil
+		}
+	}
+	rec.Err, rec.Duration = err, time.Since(rec.Time)
+
+	c.mu.Lock()
+	c.records = append(c.records, rec)
+	if c.maxRecords > 0 && len(c.records) > c.maxRecords {
+		c.records = append(c.records[:0], c.records[len(c.records)-c.maxRecords:]...)
+	}
+	c.mu.Unlock()
+	return resp, err
+}
+
+// Records returns all captured round trips in order.
+func (c *RoundTripCaptor) Records() []RoundTripRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]RoundTripRecord(nil), c.records...)
+}
+
+// Len returns the number of captured round trips.
+func (c *RoundTripCaptor) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.records)
+}
+
+// Reset removes all captured round trips.
+func (c *RoundTripCaptor) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = nil
+}
+
+// BodyJSON decodes the request body as JSON object.
+func (r RoundTripRecord) BodyJSON() (map[string]any, error) {
+	var res map[string]any
+	if err := json.Unmarshal(r.ReqBody, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	return res, nil
+}
+
+// JSONPath returns the value at path in JSON request body, like "$.user.id" or "$.items[0].name".
+// Only child fields and array indexes are supported. Numbers are returned as float64.
+func (r RoundTripRecord) JSONPath(path string) (any, error) {
+	var v any
+	if err := json.Unmarshal(r.ReqBody, &v); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	return jsonPath(v, path)
+}
+
+// AssertJSONField checks the value at JSON path in the request body of record i, see RoundTripRecord.JSONPath.
+// The want value is compared after JSON round trip, so any numeric type matches the decoded float64.
+func (c *RoundTripCaptor) AssertJSONField(t TestingT, i int, path string, want any) {
+	t.Helper()
+	recs := c.Records()
+	if i < 0 || i >= len(recs) {
+		t.Errorf("no record %d, captured %d", i, len(recs))
+		return
+	}
+	got, err := recs[i].JSONPath(path)
+	if err != nil {
+		t.Errorf("record %d: %v", i, err)
+		return
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Errorf("failed to marshal expected value: %v", err)
+		return
+	}
+	var wantNorm any
+	if err = json.Unmarshal(data, &wantNorm); err != nil {
+		t.Errorf("failed to normalize expected value: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, wantNorm) {
+		t.Errorf("record %d: %s = %v, want %v", i, path, got, wantNorm)
+	}
+}
+
+// jsonPath walks decoded JSON value v by path of field names and array indexes.
+func jsonPath(v any, path string) (any, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("path %q must start with $", path)
+	}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			key := rest[1:end]
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: not an object at %q", path, key)
+			}
+			if v, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("%s: field %q not found", path, key)
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s: unclosed [", path)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid index %q", path, rest[1:end])
+			}
+			arr, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: not an array at [%d]", path, idx)
+			}
+			if idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("%s: index %d out of range, len %d", path, idx, len(arr))
+			}
+			v, rest = arr[idx], rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q", path, rest)
+		}
+	}
+	return v, nil
+}
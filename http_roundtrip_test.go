@@ -0,0 +1,188 @@
+package testutils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCaptureRoundTripper(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Test", "value")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("got " + string(body)))
+	}))
+	defer ts.Close()
+
+	captor := CaptureRoundTripper(t, nil)
+	client := &http.Client{Transport: captor}
+
+	resp, err := client.Post(ts.URL+"/items?id=1", "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "got payload" {
+		t.Errorf("response body not passed to the client, got %q", string(body))
+	}
+
+	resp, err = client.Get(ts.URL + "/items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if captor.Len() != 2 {
+		t.Fatalf("want 2 records, got %d", captor.Len())
+	}
+	rec := captor.Records()[0]
+	if rec.Request.Method != http.MethodPost || rec.Request.URL.Path != "/items" || rec.Request.URL.Query().Get("id") != "1" {
+		t.Errorf("unexpected request %s %s", rec.Request.Method, rec.Request.URL)
+	}
+	if string(rec.ReqBody) != "payload" || rec.Request.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("unexpected request body %q or headers %v", rec.ReqBody, rec.Request.Header)
+	}
+	if rec.StatusCode != http.StatusCreated || rec.RespHeader.Get("X-Test") != "value" || string(rec.RespBody) != "got payload" {
+		t.Errorf("unexpected response %d %v %q", rec.StatusCode, rec.RespHeader, rec.RespBody)
+	}
+	if rec.Err != nil || rec.Duration <= 0 {
+		t.Errorf("unexpected error %v or duration %v", rec.Err, rec.Duration)
+	}
+
+	captor.Reset()
+	if captor.Len() != 0 {
+		t.Errorf("want no records after reset, got %d", captor.Len())
+	}
+}
+
+func TestCaptureRoundTripperError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	url := ts.URL
+	ts.Close()
+
+	captor := CaptureRoundTripper(t, http.DefaultTransport)
+	client := &http.Client{Transport: captor}
+	if resp, err := client.Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatal("want error from closed server")
+	}
+	recs := captor.Records()
+	if len(recs) != 1 || recs[0].Err == nil || recs[0].StatusCode != 0 {
+		t.Errorf("want failed round trip recorded, got %+v", recs)
+	}
+}
+
+func TestCaptureRoundTripperOptions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	captor := CaptureRoundTripper(t, nil, WithMaxRecords(3),
+		WithRequestFilter(func(r *http.Request) bool { return r.URL.Path != "/health" }))
+	client := &http.Client{Transport: captor}
+	for _, path := range []string{"/a", "/health", "/b", "/c", "/health", "/d"} {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != path {
+			t.Errorf("want %q, got %q", path, body)
+		}
+	}
+
+	var paths []string
+	for _, rec := range captor.Records() {
+		paths = append(paths, rec.Request.URL.Path)
+	}
+	if strings.Join(paths, ",") != "/b,/c,/d" {
+		t.Errorf("want last 3 non-health requests, got %v", paths)
+	}
+}
+
+func TestRoundTripRecordJSON(t *testing.T) {
+	rec := RoundTripRecord{ReqBody: []byte(`{"user":{"id":42,"name":"joe"},"items":[{"sku":"a"},{"sku":"b","tags":["x","y"]}],"ok":true}`)}
+
+	body, err := rec.BodyJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["ok"] != true {
+		t.Errorf("unexpected body %v", body)
+	}
+
+	tbl := []struct {
+		path string
+		want any
+		err  string
+	}{
+		{"$.user.id", float64(42), ""},
+		{"$.user.name", "joe", ""},
+		{"$.items[1].sku", "b", ""},
+		{"$.items[1].tags[0]", "x", ""},
+		{"$", nil, ""},
+		{"$.user.missing", nil, `field "missing" not found`},
+		{"$.items[5]", nil, "out of range"},
+		{"$.user[0]", nil, "not an array"},
+		{"$.items.sku", nil, "not an object"},
+		{"user.id", nil, "must start with $"},
+		{"$.items[x]", nil, "invalid index"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := rec.JSONPath(tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("want error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil && got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err = (RoundTripRecord{ReqBody: []byte("not json")}).BodyJSON(); err == nil {
+		t.Error("want error for invalid json")
+	}
+}
+
+func TestRoundTripCaptorAssertJSONField(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	captor := CaptureRoundTripper(t, nil)
+	resp, err := (&http.Client{Transport: captor}).Post(ts.URL, "application/json",
+		strings.NewReader(`{"user":{"id":42},"tags":["a"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	captor.AssertJSONField(t, 0, "$.user.id", 42)
+	captor.AssertJSONField(t, 0, "$.tags", []string{"a"})
+
+	for _, tt := range []struct {
+		i    int
+		path string
+		want any
+	}{{0, "$.user.id", 43}, {1, "$.user.id", 42}, {0, "$.missing", 1}} {
+		ft := &fakeT{}
+		captor.AssertJSONField(ft, tt.i, tt.path, tt.want)
+		if !ft.Failed() {
+			t.Errorf("want failure for record %d %s = %v", tt.i, tt.path, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package testutils
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// SlowConfig defines how connections of SlowListener write data, zero fields are disabled.
+type SlowConfig struct {
+	BytesPerSec int // cap of the write rate for each connection
+	StallAfter  int // stop writing after this number of bytes, until the client or the listener is closed
+	CloseAfter  int // close the connection after writing this number of bytes, cutting the response
+}
+
+// errSlowConnClosed is returned by writes cut by SlowConfig.CloseAfter or the stall released by close.
+var errSlowConnClosed = errors.New("connection closed by slow listener")
+
+// SlowListener wraps l to make accepted connections write slowly or partially according to cfg.
+// Use it with httptest.NewUnstartedServer, replacing the server Listener before Start, to test
+// client read timeouts and handling of partial responses. Limits apply to the raw connection bytes,
+// including HTTP status line and headers. Stalled writes are released when the client disconnects
+// or the listener is closed, so closing the test server doesn't hang.
+func SlowListener(l net.Listener, cfg SlowConfig) net.Listener {
+	return &slowListener{Listener: l, cfg: cfg, done: make(chan struct{})}
+}
+
+type slowListener struct {
+	net.Listener
+	cfg      SlowConfig
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Accept returns the next connection wrapped to apply the configured limits.
+func (l *slowListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &slowConn{Conn: conn, cfg: l.cfg, listenerDone: l.done, closed: make(chan struct{})}, nil
+}
+
+// Close closes the listener and releases all stalled connections.
+func (l *slowListener) Close() error {
+	l.doneOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+type slowConn struct {
+	net.Conn
+	cfg          SlowConfig
+	listenerDone chan struct{}
+
+	mu         sync.Mutex
+	written    int
+	closed     chan struct{}
+	closedOnce sync.Once
+}
+
+// Read passes through, a read error means the client is gone and releases the stalled write.
+func (c *slowConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		c.release()
+	}
+	return n, err
+}
+
+// Write writes p applying rate, stall and close limits.
+func (c *slowConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for len(p) > 0 {
+		chunk := p
+		if c.cfg.BytesPerSec > 0 {
+			// write in portions of 1/10 of the rate to keep the pace smooth
+			chunk = p[:min(len(p), max(1, c.cfg.BytesPerSec/10))]
+		}
+		if c.cfg.StallAfter > 0 && c.written+len(chunk) > c.cfg.StallAfter {
+			chunk = chunk[:c.cfg.StallAfter-c.written]
+		}
+		if c.cfg.CloseAfter > 0 && c.written+len(chunk) > c.cfg.CloseAfter {
+			chunk = chunk[:c.cfg.CloseAfter-c.written]
+		}
+
+		n, err := c.Conn.Write(chunk)
+		total += n
+		c.written += n
+		p = p[n:]
+		if err != nil {
+			return total, err
+		}
+
+		if c.cfg.CloseAfter > 0 && c.written >= c.cfg.CloseAfter && len(p) > 0 {
+			_ = c.Close()
+			return total, errSlowConnClosed
+		}
+		if c.cfg.StallAfter > 0 && c.written >= c.cfg.StallAfter && len(p) > 0 {
+			select {
+			case <-c.closed:
+			case <-c.listenerDone:
+			}
+			_ = c.Close()
+			return total, errSlowConnClosed
+		}
+		if c.cfg.BytesPerSec > 0 {
+			time.Sleep(time.Duration(n) * time.Second / time.Duration(c.cfg.BytesPerSec))
+		}
+	}
+	return total, nil
+}
+
+// Close closes the connection and releases the stalled write.
+func (c *slowConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
+
+func (c *slowConn) release() {
+	c.closedOnce.Do(func() { close(c.closed) })
+}
@@ -0,0 +1,105 @@
+package testutils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowListener(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	start := func(t *testing.T, cfg SlowConfig) string {
+		t.Helper()
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, body)
+		}))
+		ts.Listener = SlowListener(ts.Listener, cfg)
+		ts.Start()
+		t.Cleanup(ts.Close)
+		return ts.URL
+	}
+
+	t.Run("rate", func(t *testing.T) {
+		url := start(t, SlowConfig{BytesPerSec: 5000})
+		st := time.Now()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != body {
+			t.Errorf("unexpected body of %d bytes", len(data))
+		}
+		// headers and body are over 1000 bytes, at least 200ms at 5000 bytes/sec
+		if since := time.Since(st); since < 200*time.Millisecond {
+			t.Errorf("response is too fast, %v", since)
+		}
+	})
+
+	t.Run("close after", func(t *testing.T) {
+		url := start(t, SlowConfig{CloseAfter: 300})
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err == nil {
+			t.Errorf("want error for cut body, got %d bytes", len(data))
+		}
+		if len(data) == 0 || len(data) >= len(body) {
+			t.Errorf("want partial body, got %d bytes", len(data))
+		}
+	})
+
+	t.Run("stall after", func(t *testing.T) {
+		url := start(t, SlowConfig{StallAfter: 300})
+		client := http.Client{Timeout: 200 * time.Millisecond}
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err == nil || !strings.Contains(err.Error(), "Client.Timeout") {
+			t.Errorf("want client timeout, got %v", err)
+		}
+		if len(data) == 0 || len(data) >= len(body) {
+			t.Errorf("want partial body, got %d bytes", len(data))
+		}
+	})
+
+	t.Run("stall released on server close", func(t *testing.T) {
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, body)
+		}))
+		ts.Listener = SlowListener(ts.Listener, SlowConfig{StallAfter: 10})
+		ts.Start()
+		go func() {
+			resp, err := http.Get(ts.URL)
+			if err == nil {
+				_, _ = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		done := make(chan struct{})
+		go func() {
+			ts.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("server close hangs on stalled connection")
+		}
+	})
+}
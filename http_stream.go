@@ -0,0 +1,73 @@
+package testutils
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// ChunkedHandler returns a handler writing chunks with chunked transfer encoding, flushing each one
+// to the client and pausing for interval between them. It stops early if the client disconnects.
+// Useful for testing incremental reading and per-read timeouts of streaming clients.
+func ChunkedHandler(interval time.Duration, chunks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, _ := w.(http.Flusher)
+		for i, chunk := range chunks {
+			if i > 0 && !sleepCtx(r, interval) {
+				return
+			}
+			if _, err := io.WriteString(w, chunk); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// StreamHandler returns a handler streaming chunks produced by gen, called with the sequential
+// chunk number starting from 0, every interval. The stream never ends by itself: it stops when the client
+// disconnects or the test completes. As httptest.Server.Close waits for active requests, register the
+// server cleanup after creating the handler, so the stream is released first.
+func StreamHandler(t *testing.T, interval time.Duration, gen func(i int) string) http.HandlerFunc {
+	t.Helper()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, _ := w.(http.Flusher)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			if _, err := io.WriteString(w, gen(i)); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// sleepCtx pauses for d and returns false if the request is canceled before.
+func sleepCtx(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return r.Context().Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+package testutils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkedHandler(t *testing.T) {
+	ts := httptest.NewServer(ChunkedHandler(50*time.Millisecond, "one\n", "two\n", "three\n"))
+	defer ts.Close()
+
+	st := time.Now()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("want chunked response, got %v", resp.TransferEncoding)
+	}
+
+	rd := bufio.NewReader(resp.Body)
+	line, err := rd.ReadString('\n')
+	if err != nil || line != "one\n" {
+		t.Fatalf("unexpected first chunk %q, %v", line, err)
+	}
+	rest, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "two\nthree\n" {
+		t.Errorf("unexpected rest %q", rest)
+	}
+	if since := time.Since(st); since < 100*time.Millisecond {
+		t.Errorf("chunks should be paced, took %v", since)
+	}
+
+	t.Run("client timeout", func(t *testing.T) {
+		client := http.Client{Timeout: 75 * time.Millisecond}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if _, err = io.ReadAll(resp.Body); err == nil {
+			t.Error("want timeout error reading the body")
+		}
+	})
+}
+
+func TestStreamHandler(t *testing.T) {
+	h := StreamHandler(t, 10*time.Millisecond, func(i int) string { return fmt.Sprintf("event %d\n", i) })
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := bufio.NewReader(resp.Body)
+	for i := 0; i < 5; i++ {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("event %d\n", i); line != want {
+			t.Errorf("want %q, got %q", want, line)
+		}
+	}
+	resp.Body.Close() // client disconnect stops the stream
+}
+
+func TestStreamHandler_StopsOnCleanup(t *testing.T) {
+	done := make(chan struct{})
+	rec := httptest.NewRecorder()
+	t.Run("stream", func(t *testing.T) {
+		h := StreamHandler(t, 5*time.Millisecond, func(int) string { return "x" })
+		go func() {
+			h(rec, httptest.NewRequest("GET", "/", http.NoBody))
+			close(done)
+		}()
+		time.Sleep(30 * time.Millisecond)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream not stopped on test cleanup")
+	}
+	if body := rec.Body.String(); len(body) < 2 || strings.Trim(body, "x") != "" {
+		t.Errorf("unexpected streamed body %q", body)
+	}
+}
@@ -0,0 +1,152 @@
+package testutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCerts is a test CA with server and client certificates issued by it,
+// for testing TLS and mutual TLS connections.
+type TestCerts struct {
+	CA     *x509.Certificate
+	CAPEM  []byte // PEM-encoded CA certificate, for tools and configs expecting a file
+	Server tls.Certificate
+	Client tls.Certificate
+}
+
+// GenerateTestCerts generates a test CA, a server certificate for the given hosts (DNS names or IPs,
+// localhost and loopback addresses by default) and a client certificate. Certificates are valid for a day.
+func GenerateTestCerts(t *testing.T, hosts ...string) *TestCerts {
+	t.Helper()
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	caTmpl := certTemplate(t, "testutils CA")
+	caTmpl.IsCA = true
+	caTmpl.BasicConstraintsValid = true
+	caTmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+
+	serverTmpl := certTemplate(t, hosts[0])
+	serverTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			serverTmpl.IPAddresses = append(serverTmpl.IPAddresses, ip)
+			continue
+		}
+		serverTmpl.DNSNames = append(serverTmpl.DNSNames, h)
+	}
+	clientTmpl := certTemplate(t, "testutils client")
+	clientTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	res := &TestCerts{CA: ca, CAPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})}
+	if res.Server, err = issueCert(serverTmpl, ca, caKey); err != nil {
+		t.Fatalf("failed to issue server certificate: %v", err)
+	}
+	if res.Client, err = issueCert(clientTmpl, ca, caKey); err != nil {
+		t.Fatalf("failed to issue client certificate: %v", err)
+	}
+	return res
+}
+
+// ServerTLSConfig returns a server config with the server certificate, requiring and verifying
+// client certificates issued by the test CA.
+func (c *TestCerts) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.Server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    c.pool(),
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// ClientTLSConfig returns a client config trusting the test CA and presenting the client certificate.
+func (c *TestCerts) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.Client},
+		RootCAs:      c.pool(),
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+func (c *TestCerts) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.CA)
+	return pool
+}
+
+// MockMTLSServer starts a TLS server with the handler, requiring client certificates issued by a test CA.
+// It returns the server URL, a client presenting a valid client certificate, and generated certificates,
+// which can be used to build clients with other settings. The server is closed automatically
+// when the test completes.
+func MockMTLSServer(t *testing.T, h http.Handler) (url string, client *http.Client, certs *TestCerts) {
+	t.Helper()
+	certs = GenerateTestCerts(t)
+	ts := httptest.NewUnstartedServer(h)
+	ts.TLS = certs.ServerTLSConfig()
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: certs.ClientTLSConfig()},
+		Timeout:   30 * time.Second,
+	}
+	t.Cleanup(client.CloseIdleConnections)
+	return ts.URL, client, certs
+}
+
+func certTemplate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		t.Fatalf("failed to generate serial: %v", err)
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"testutils"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+}
+
+// issueCert generates a key and a certificate for the template signed by the CA.
+func issueCert(tmpl, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate key: %w", err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("parse certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der, ca.Raw}, PrivateKey: key, Leaf: leaf}, nil
+}
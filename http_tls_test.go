@@ -0,0 +1,60 @@
+package testutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestGenerateTestCerts(t *testing.T) {
+	certs := GenerateTestCerts(t, "example.test", "10.0.0.1")
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(certs.CAPEM) {
+		t.Fatal("invalid CA PEM")
+	}
+
+	if _, err := certs.Server.Leaf.Verify(x509.VerifyOptions{DNSName: "example.test", Roots: pool}); err != nil {
+		t.Errorf("server cert not valid for dns name: %v", err)
+	}
+	if _, err := certs.Server.Leaf.Verify(x509.VerifyOptions{DNSName: "10.0.0.1", Roots: pool}); err != nil {
+		t.Errorf("server cert not valid for ip: %v", err)
+	}
+	if _, err := certs.Server.Leaf.Verify(x509.VerifyOptions{DNSName: "other.test", Roots: pool}); err == nil {
+		t.Error("server cert valid for unexpected host")
+	}
+	_, err := certs.Client.Leaf.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	if err != nil {
+		t.Errorf("client cert not valid: %v", err)
+	}
+}
+
+func TestMockMTLSServer(t *testing.T) {
+	url, client, certs := MockMTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "testutils client" {
+		t.Errorf("want client cn, got %q", string(body))
+	}
+
+	// client trusting the server but without a certificate is rejected
+	noCertClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: certs.ClientTLSConfig().RootCAs, MinVersion: tls.VersionTLS12},
+	}}
+	defer noCertClient.CloseIdleConnections()
+	if resp, err := noCertClient.Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("want error without client certificate")
+	}
+}
@@ -0,0 +1,272 @@
+package testutils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// MockHTTPSServer starts a TLS server with the handler and returns its URL and a client trusting
+// the server certificate, so HTTPS-only code can be tested without InsecureSkipVerify.
+// The server is closed automatically when the test completes.
+func MockHTTPSServer(t *testing.T, h http.Handler) (url string, client *http.Client) {
+	t.Helper()
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+	return ts.URL, ts.Client()
+}
+
+// MockHTTP2Server starts a TLS server with the handler negotiating HTTP/2, and returns its URL and
+// a client trusting the server certificate and using HTTP/2, for testing code relying on protocol
+// version or HTTP/2 streaming. See MockH2CServer for cleartext HTTP/2. The server is closed automatically
+// when the test completes.
+func MockHTTP2Server(t *testing.T, h http.Handler) (url string, client *http.Client) {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(h)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts.URL, ts.Client()
+}
+
+// MockH2CServer starts a cleartext server with the handler accepting HTTP/2 without TLS (h2c), as used
+// behind TLS-terminating proxies and by gRPC without TLS, and returns its http URL and a client speaking
+// HTTP/2 with prior knowledge. HTTP/1.1 clients are served too. The server is closed automatically
+// when the test completes.
+func MockH2CServer(t *testing.T, h http.Handler) (url string, client *http.Client) {
+	t.Helper()
+	ts := httptest.NewServer(h2c.NewHandler(h, &http2.Server{}))
+	t.Cleanup(ts.Close)
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		// prior knowledge: plain TCP connection instead of TLS, no upgrade from HTTP/1.1
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return ts.URL, &http.Client{Transport: transport}
+}
+
+// MockHTTPServerUnix starts a test server with the handler listening on a unix socket in a temporary
+// directory, and returns the socket path and a client connecting to it for any URL, like "http://unix/path".
+// Use it for testing code talking to docker-style local sockets. The server is closed and the socket
+// removed automatically when the test completes.
+func MockHTTPServerUnix(t *testing.T, h http.Handler) (socket string, client *http.Client) {
+	t.Helper()
+	// socket path length is limited to ~100 bytes, t.TempDir can be too long
+	dir, err := os.MkdirTemp("", "tu-sock")
+	if err != nil {
+		t.Fatalf("failed to create socket dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket = filepath.Join(dir, "http.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socket, err)
+	}
+
+	ts := httptest.NewUnstartedServer(h)
+	_ = ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	transport := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	}}
+	t.Cleanup(transport.CloseIdleConnections)
+	return socket, &http.Client{Transport: transport}
+}
+
+// ControlledServer is a test server started by MockControlledServer, which can go away mid-test
+// and come back on the same address. It is safe for concurrent use.
+type ControlledServer struct {
+	URL string
+
+	h    http.Handler
+	addr string
+	mu   sync.Mutex
+	ts   *httptest.Server
+}
+
+// MockControlledServer starts a test server with the handler and returns ControlledServer with its URL,
+// allowing to stop it, restart it on the same address and drop active connections on demand, for testing
+// client reconnect and failover logic. The server is closed automatically when the test completes.
+func MockControlledServer(t *testing.T, h http.Handler) *ControlledServer {
+	t.Helper()
+	s := &ControlledServer{h: h, ts: httptest.NewServer(h)}
+	s.URL, s.addr = s.ts.URL, s.ts.Listener.Addr().String()
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// Stop drops active connections and closes the server, so new connections are refused.
+// It does nothing if the server is already stopped.
+func (s *ControlledServer) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+func (s *ControlledServer) stop() {
+	if s.ts == nil {
+		return
+	}
+	s.ts.CloseClientConnections()
+	s.ts.Close()
+	s.ts = nil
+}
+
+// Restart stops the server, if running, and starts it again on the same address.
+func (s *ControlledServer) Restart() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+	ts := httptest.NewUnstartedServer(s.h)
+	_ = ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	s.ts = ts
+	return nil
+}
+
+// DropConnections closes all active client connections, keeping the server running.
+func (s *ControlledServer) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ts != nil {
+		s.ts.CloseClientConnections()
+	}
+}
+
+// RateLimitedHTTPServer starts a test server passing up to rps requests per second to the handler,
+// allowing bursts of up to burst requests. Requests over the budget get 429 Too Many Requests
+// with Retry-After header set to the number of seconds until the next request is allowed.
+// The server is closed automatically when the test completes.
+func RateLimitedHTTPServer(t *testing.T, h http.Handler, rps float64, burst int) string {
+	t.Helper()
+	if rps <= 0 || burst < 1 {
+		t.Fatalf("invalid rate limit %v rps with burst %d", rps, burst)
+	}
+	tb := &tokenBucket{rate: rps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := tb.take(); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// ClosedPortURL returns http URL on localhost with a port nobody listens on, so connections to it
+// are refused. The port is obtained from the OS and released right away, so there is a tiny chance
+// of another listener taking it in between.
+func ClosedPortURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to get free port: %v", err)
+	}
+	addr := l.Addr().String()
+	if err = l.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+	return "http://" + addr
+}
+
+// BlackholeServer starts a server accepting connections and reading everything sent to them,
+// but never responding, and returns its http URL. Use it for testing response and read timeouts.
+// Connections are closed when the test completes.
+func BlackholeServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	var closed bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return // listener closed
+			}
+			mu.Lock()
+			if closed {
+				// accepted right before the cleanup closed the listener
+				mu.Unlock()
+				_ = conn.Close()
+				return
+			}
+			conns = append(conns, conn)
+			wg.Add(1)
+			mu.Unlock()
+			go func() {
+				defer wg.Done()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	t.Cleanup(func() {
+		mu.Lock()
+		closed = true
+		_ = l.Close()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	})
+	return "http://" + l.Addr().String()
+}
+
+// tokenBucket is a simple token bucket rate limiter.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token if available, otherwise returns the time until the next token.
+func (b *tokenBucket) take() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,273 @@
+package testutils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockHTTPSServer(t *testing.T) {
+	url, client := MockHTTPSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			t.Error("want TLS request")
+		}
+		_, _ = w.Write([]byte("secure"))
+	}))
+	if !strings.HasPrefix(url, "https://") {
+		t.Fatalf("want https url, got %s", url)
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "secure" {
+		t.Errorf("want %q, got %q", "secure", string(body))
+	}
+
+	// default client doesn't trust the test certificate
+	if resp, err := http.Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("want certificate error with default client")
+	}
+}
+
+func TestMockHTTP2Server(t *testing.T) {
+	url, client := MockHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	if !strings.HasPrefix(url, "https://") {
+		t.Fatalf("want https url, got %s", url)
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Errorf("want HTTP/2 on both sides, got client %s, server %s", resp.Proto, body)
+	}
+
+	// HTTP/1.1-only client still works with the server
+	h1 := client.Transport.(*http.Transport).Clone()
+	h1.ForceAttemptHTTP2 = false
+	h1.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	resp, err = (&http.Client{Transport: h1}).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("want HTTP/1.1 fallback, got %s", resp.Proto)
+	}
+}
+
+func TestMockH2CServer(t *testing.T) {
+	url, client := MockH2CServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	if !strings.HasPrefix(url, "http://") {
+		t.Fatalf("want cleartext url, got %s", url)
+	}
+	get := func(t *testing.T, client *http.Client) (*http.Response, string) {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get(t, client)
+	if resp.ProtoMajor != 2 || body != "HTTP/2.0" {
+		t.Errorf("want h2c on both sides, got client %s, server %s", resp.Proto, body)
+	}
+
+	resp, body = get(t, http.DefaultClient)
+	if resp.ProtoMajor != 1 || body != "HTTP/1.1" {
+		t.Errorf("want HTTP/1.1 for plain client, got client %s, server %s", resp.Proto, body)
+	}
+}
+
+func TestMockHTTPServerUnix(t *testing.T) {
+	socket, client := MockHTTPServerUnix(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("path " + r.URL.Path))
+	}))
+	if _, err := os.Stat(socket); err != nil {
+		t.Fatalf("socket not created: %v", err)
+	}
+	resp, err := client.Get("http://unix/containers/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "path /containers/json" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestMockControlledServer(t *testing.T) {
+	started := make(chan struct{}, 1)
+	srv := MockControlledServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			started <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	// client timeout is much longer than waits below, so only dropped connection can end /slow in time
+	client := &http.Client{Timeout: 30 * time.Second}
+	defer client.CloseIdleConnections()
+	get := func(path string) (string, error) {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if body, err := get("/"); err != nil || body != "ok" {
+		t.Fatalf("want ok, got %q, %v", body, err)
+	}
+
+	srv.Stop()
+	srv.Stop() // no-op for stopped server
+	if _, err := get("/"); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("want connection refused after stop, got %v", err)
+	}
+
+	if err := srv.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := get("/"); err != nil || body != "ok" {
+		t.Fatalf("want ok after restart on the same address, got %q, %v", body, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := get("/slow")
+		done <- err
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow request not started")
+	}
+	srv.DropConnections()
+	select {
+	case err := <-done:
+		if err == nil || strings.Contains(err.Error(), "Client.Timeout") {
+			t.Errorf("want error for dropped connection, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection not dropped")
+	}
+	if body, err := get("/"); err != nil || body != "ok" {
+		t.Errorf("want server running after drop, got %q, %v", body, err)
+	}
+
+	if err := srv.Restart(); err != nil { // restart of running server
+		t.Fatal(err)
+	}
+	if body, err := get("/"); err != nil || body != "ok" {
+		t.Errorf("want ok after second restart, got %q, %v", body, err)
+	}
+}
+
+func TestRateLimitedHTTPServer(t *testing.T) {
+	url := RateLimitedHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}), 1, 3)
+
+	var codes []int
+	var retryAfter string
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		codes = append(codes, resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			retryAfter = resp.Header.Get("Retry-After")
+		}
+	}
+	want := []int{200, 200, 200, 429, 429}
+	if fmt.Sprint(codes) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, codes)
+	}
+	if retryAfter != "1" {
+		t.Errorf("want Retry-After 1, got %q", retryAfter)
+	}
+
+	time.Sleep(1100 * time.Millisecond) // a token is refilled every second
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("want 200 after refill, got %d", resp.StatusCode)
+	}
+}
+
+func TestClosedPortURL(t *testing.T) {
+	url := ClosedPortURL(t)
+	if !strings.HasPrefix(url, "http://127.0.0.1:") {
+		t.Fatalf("unexpected url %s", url)
+	}
+	_, err := http.Get(url)
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("want connection refused, got %v", err)
+	}
+}
+
+func TestBlackholeServer(t *testing.T) {
+	url := BlackholeServer(t)
+	client := http.Client{Timeout: 100 * time.Millisecond}
+	st := time.Now()
+	_, err := client.Post(url+"/api", "text/plain", strings.NewReader("data"))
+	if err == nil || !strings.Contains(err.Error(), "Client.Timeout") {
+		t.Errorf("want client timeout, got %v", err)
+	}
+	if since := time.Since(st); since < 100*time.Millisecond {
+		t.Errorf("request returned too early, %v", since)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := &tokenBucket{rate: 10, burst: 1, tokens: 1, last: time.Now()}
+	if wait := tb.take(); wait != 0 {
+		t.Errorf("want token available, got wait %v", wait)
+	}
+	if wait := tb.take(); wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("want wait up to 100ms, got %v", wait)
+	}
+}
@@ -0,0 +1,172 @@
+package testutils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSMessage is a WebSocket data frame, Type is websocket.TextMessage or websocket.BinaryMessage.
+type WSMessage struct {
+	Type int
+	Data []byte
+}
+
+// WSServer is a mock WebSocket server started by MockWSServer. It captures all frames received
+// from clients and close codes they sent, and can push frames to connected clients.
+type WSServer struct {
+	URL string // ws:// URL of the server
+
+	handler func(c *WSConn, msg WSMessage)
+
+	mu         sync.Mutex
+	conns      map[*WSConn]struct{}
+	closed     bool // set on cleanup, connections upgraded after it are closed right away
+	messages   []WSMessage
+	closeCodes []int
+}
+
+// WSConn is a server side connection of WSServer, safe for concurrent use.
+type WSConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// MockWSServer starts a WebSocket test server and returns WSServer with ws:// URL to connect to.
+// All received data frames are captured, then passed to handler, if not nil, to respond with WSConn.Send.
+// Connections and the server are closed on test cleanup.
+func MockWSServer(t *testing.T, handler func(c *WSConn, msg WSMessage)) *WSServer {
+	t.Helper()
+	s := &WSServer{handler: handler, conns: map[*WSConn]struct{}{}}
+	ts := httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(ts.URL, "http")
+	t.Cleanup(func() {
+		s.mu.Lock()
+		s.closed = true
+		for c := range s.conns {
+			_ = c.conn.Close()
+		}
+		s.mu.Unlock()
+		ts.Close()
+	})
+	return s
+}
+
+func (s *WSServer) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // upgrader already responded with an error
+	}
+	defer conn.Close()
+	c := &WSConn{conn: conn}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		mt, data, err := conn.ReadMessage()
+		if err != nil {
+			code := websocket.CloseAbnormalClosure
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				code = closeErr.Code
+			}
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.closeCodes = append(s.closeCodes, code)
+			s.mu.Unlock()
+			return
+		}
+		msg := WSMessage{Type: mt, Data: data}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		s.mu.Unlock()
+		if s.handler != nil {
+			s.handler(c, msg)
+		}
+	}
+}
+
+// Messages returns all data frames received from all clients, in order.
+func (s *WSServer) Messages() []WSMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WSMessage(nil), s.messages...)
+}
+
+// Conns returns the number of currently connected clients.
+func (s *WSServer) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Broadcast sends a frame to all connected clients and returns the first error, if any.
+func (s *WSServer) Broadcast(msgType int, data []byte) error {
+	s.mu.Lock()
+	conns := make([]*WSConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	var res error
+	for _, c := range conns {
+		if err := c.Send(msgType, data); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// CloseCodes returns close codes of all disconnected clients, in order. Connections dropped
+// without a close frame are reported as websocket.CloseAbnormalClosure.
+func (s *WSServer) CloseCodes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.closeCodes...)
+}
+
+// AssertCloseCode waits for any client to disconnect with the close code and fails the test
+// if it doesn't happen within timeout.
+func (s *WSServer) AssertCloseCode(t TestingT, code int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		codes := s.CloseCodes()
+		for _, c := range codes {
+			if c == code {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("close code %d not received within %v, got %v", code, timeout, codes)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Send sends a frame to the client.
+func (c *WSConn) Send(msgType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(msgType, data)
+}
+
+// Close sends a close frame with code and reason to the client, which is expected to close the connection.
+func (c *WSConn) Close(code int, reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
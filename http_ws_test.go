@@ -0,0 +1,95 @@
+package testutils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMockWSServer(t *testing.T) {
+	srv := MockWSServer(t, func(c *WSConn, msg WSMessage) {
+		if string(msg.Data) == "bye" {
+			_ = c.Close(websocket.CloseGoingAway, "server bye")
+			return
+		}
+		_ = c.Send(msg.Type, append([]byte("echo "), msg.Data...))
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	mt, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt != websocket.TextMessage || string(data) != "echo hello" {
+		t.Errorf("unexpected reply %d %q", mt, data)
+	}
+
+	if srv.Conns() != 1 {
+		t.Errorf("want 1 connection, got %d", srv.Conns())
+	}
+	if err = srv.Broadcast(websocket.BinaryMessage, []byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if mt, data, err = conn.ReadMessage(); err != nil || mt != websocket.BinaryMessage || string(data) != "\x01\x02" {
+		t.Errorf("unexpected pushed frame %d %q %v", mt, data, err)
+	}
+
+	if err = conn.WriteMessage(websocket.TextMessage, []byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway || closeErr.Text != "server bye" {
+		t.Errorf("want close from server, got %v", err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 2 || string(msgs[0].Data) != "hello" || string(msgs[1].Data) != "bye" {
+		t.Errorf("unexpected captured messages %+v", msgs)
+	}
+}
+
+func TestMockWSServer_CloseCodes(t *testing.T) {
+	srv := MockWSServer(t, nil)
+
+	conn, _, err := websocket.DefaultDialer.Dial(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "done")
+	if err = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	srv.AssertCloseCode(t, websocket.CloseNormalClosure, time.Second)
+	conn.Close()
+
+	conn, _, err = websocket.DefaultDialer.Dial(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close() // dropped without a close frame
+	srv.AssertCloseCode(t, websocket.CloseAbnormalClosure, time.Second)
+
+	if codes := srv.CloseCodes(); len(codes) != 2 {
+		t.Errorf("want 2 close codes, got %v", codes)
+	}
+	if srv.Conns() != 0 {
+		t.Errorf("want no connections, got %d", srv.Conns())
+	}
+
+	ft := &fakeT{}
+	srv.AssertCloseCode(ft, websocket.CloseGoingAway, 20*time.Millisecond)
+	if !ft.Failed() {
+		t.Error("want failure for missing close code")
+	}
+}
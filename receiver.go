@@ -0,0 +1,62 @@
+package testutils
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// udpReceiver listens on a local UDP port and passes each received packet to handle.
+type udpReceiver struct {
+	conn net.PacketConn
+
+	mu    sync.Mutex
+	count int // number of received records, for waiting
+}
+
+func newUDPReceiver(t *testing.T, handle func(packet []byte) int) *udpReceiver {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen udp: %v", err)
+	}
+	r := &udpReceiver{conn: conn}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 64*1024)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return // closed
+			}
+			added := handle(append([]byte(nil), buf[:n]...))
+			r.mu.Lock()
+			r.count += added
+			r.mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		<-done
+	})
+	return r
+}
+
+// wait waits for n records received and reports if it happened within timeout.
+func (r *udpReceiver) wait(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		r.mu.Lock()
+		count := r.count
+		r.mu.Unlock()
+		if count >= n {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,180 @@
+package testutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// StatsdMetric is a metric line parsed by StatsdReceiver, like "api.requests:1|c|@0.5|#env:prod".
+type StatsdMetric struct {
+	Name       string
+	Value      float64 // zero for non-numeric set values, see Raw
+	Type       string  // c, g, ms, h, s or d
+	SampleRate float64 // 1 if not set
+	Tags       map[string]string
+	Raw        string
+}
+
+// StatsdReceiver is a statsd server listening on a local UDP port, started by NewStatsdReceiver.
+type StatsdReceiver struct {
+	Addr string // host:port to send metrics to
+
+	udp     *udpReceiver
+	mu      sync.Mutex
+	metrics []StatsdMetric
+}
+
+// NewStatsdReceiver starts a UDP statsd receiver parsing metric lines, including DogStatsD tags,
+// and returns it with the address to send metrics to. Packets can have multiple lines. Lines failed
+// to parse are reported as test errors. The receiver is closed when the test completes.
+func NewStatsdReceiver(t *testing.T) *StatsdReceiver {
+	t.Helper()
+	r := &StatsdReceiver{}
+	r.udp = newUDPReceiver(t, func(packet []byte) int {
+		added := 0
+		for _, line := range strings.Split(string(packet), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			m, err := ParseStatsdLine(line)
+			if err != nil {
+				t.Errorf("statsd receiver: %v", err)
+				continue
+			}
+			r.mu.Lock()
+			r.metrics = append(r.metrics, m)
+			r.mu.Unlock()
+			added++
+		}
+		return added
+	})
+	r.Addr = r.udp.conn.LocalAddr().String()
+	return r
+}
+
+// Metrics returns all received metrics, in order.
+func (r *StatsdReceiver) Metrics() []StatsdMetric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StatsdMetric(nil), r.metrics...)
+}
+
+// WaitMetrics waits for at least n metrics received and returns all of them. It fails the test
+// if they are not received within timeout.
+func (r *StatsdReceiver) WaitMetrics(t TestingT, n int, timeout time.Duration) []StatsdMetric {
+	t.Helper()
+	if !r.udp.wait(n, timeout) {
+		t.Errorf("want %d statsd metrics within %v, got %d", n, timeout, len(r.Metrics()))
+	}
+	return r.Metrics()
+}
+
+// AssertCounter checks the sum of received values of counter name, not scaled by the sample rate.
+func (r *StatsdReceiver) AssertCounter(t TestingT, name string, want float64) {
+	t.Helper()
+	sum, found := 0.0, false
+	for _, m := range r.Metrics() {
+		if m.Name == name && m.Type == "c" {
+			sum, found = sum+m.Value, true
+		}
+	}
+	if !found {
+		t.Errorf("counter %q not received", name)
+		return
+	}
+	if sum != want {
+		t.Errorf("counter %q = %v, want %v", name, sum, want)
+	}
+}
+
+// AssertGauge checks the last received value of gauge name. Signed values are applied as deltas
+// to the previous value, as statsd does.
+func (r *StatsdReceiver) AssertGauge(t TestingT, name string, want float64) {
+	t.Helper()
+	val, found := 0.0, false
+	for _, m := range r.Metrics() {
+		if m.Name != name || m.Type != "g" {
+			continue
+		}
+		found = true
+		if strings.HasPrefix(statsdRawValue(m.Raw), "+") || strings.HasPrefix(statsdRawValue(m.Raw), "-") {
+			val += m.Value
+			continue
+		}
+		val = m.Value
+	}
+	if !found {
+		t.Errorf("gauge %q not received", name)
+		return
+	}
+	if val != want {
+		t.Errorf("gauge %q = %v, want %v", name, val, want)
+	}
+}
+
+// AssertReceived checks at least one metric name of type typ was received, any type if typ is empty.
+func (r *StatsdReceiver) AssertReceived(t TestingT, name, typ string) {
+	t.Helper()
+	for _, m := range r.Metrics() {
+		if m.Name == name && (typ == "" || m.Type == typ) {
+			return
+		}
+	}
+	t.Errorf("metric %q of type %q not received", name, typ)
+}
+
+// ParseStatsdLine parses a statsd metric line "name:value|type[|@rate][|#tag:val,tag]".
+func ParseStatsdLine(line string) (StatsdMetric, error) {
+	res := StatsdMetric{Raw: line, SampleRate: 1}
+	name, rest, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok || name == "" {
+		return res, fmt.Errorf("no metric name in statsd line %q", line)
+	}
+	res.Name = name
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return res, fmt.Errorf("no metric type in statsd line %q", line)
+	}
+	res.Type = parts[1]
+	switch res.Type {
+	case "c", "g", "ms", "h", "d":
+		v, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return res, fmt.Errorf("invalid value in statsd line %q: %w", line, err)
+		}
+		res.Value = v
+	case "s":
+		res.Value, _ = strconv.ParseFloat(parts[0], 64)
+	default:
+		return res, fmt.Errorf("unknown metric type %q in statsd line %q", res.Type, line)
+	}
+
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil {
+				return res, fmt.Errorf("invalid sample rate in statsd line %q: %w", line, err)
+			}
+			res.SampleRate = rate
+		case strings.HasPrefix(p, "#"):
+			res.Tags = map[string]string{}
+			for _, tag := range strings.Split(p[1:], ",") {
+				k, v, _ := strings.Cut(tag, ":")
+				res.Tags[k] = v
+			}
+		}
+	}
+	return res, nil
+}
+
+// statsdRawValue returns the value part of raw statsd line.
+func statsdRawValue(raw string) string {
+	_, rest, _ := strings.Cut(strings.TrimSpace(raw), ":")
+	v, _, _ := strings.Cut(rest, "|")
+	return v
+}
@@ -0,0 +1,85 @@
+package testutils
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	tbl := []struct {
+		line string
+		want StatsdMetric
+		err  bool
+	}{
+		{line: "api.requests:1|c", want: StatsdMetric{Name: "api.requests", Value: 1, Type: "c", SampleRate: 1}},
+		{line: "api.latency:12.5|ms|@0.1", want: StatsdMetric{Name: "api.latency", Value: 12.5, Type: "ms", SampleRate: 0.1}},
+		{line: "queue.size:-3|g|#env:prod,region:eu,canary", want: StatsdMetric{Name: "queue.size", Value: -3, Type: "g", SampleRate: 1,
+			Tags: map[string]string{"env": "prod", "region": "eu", "canary": ""}}},
+		{line: "users:joe|s", want: StatsdMetric{Name: "users", Type: "s", SampleRate: 1}},
+		{line: "size:100|d|@0.5|#a:b", want: StatsdMetric{Name: "size", Value: 100, Type: "d", SampleRate: 0.5, Tags: map[string]string{"a": "b"}}},
+		{line: "no-value", err: true},
+		{line: ":1|c", err: true},
+		{line: "x:1", err: true},
+		{line: "x:abc|c", err: true},
+		{line: "x:1|zz", err: true},
+		{line: "x:1|c|@fast", err: true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseStatsdLine(tt.line)
+			if tt.err {
+				if err == nil {
+					t.Errorf("want error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Raw = tt.line
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStatsdReceiver(t *testing.T) {
+	r := NewStatsdReceiver(t)
+	conn, err := net.Dial("udp", r.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, packet := range []string{"hits:1|c\nhits:2|c|@0.5\n", "temp:20|g", "temp:+5|g\ntemp:-2|g", "latency:15|ms|#route:/api"} {
+		if _, err = conn.Write([]byte(packet)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metrics := r.WaitMetrics(t, 6, time.Second)
+	if len(metrics) != 6 {
+		t.Fatalf("want 6 metrics, got %+v", metrics)
+	}
+	r.AssertCounter(t, "hits", 3)
+	r.AssertGauge(t, "temp", 23)
+	r.AssertReceived(t, "latency", "ms")
+	r.AssertReceived(t, "latency", "")
+
+	for name, check := range map[string]func(ft *fakeT){
+		"counter value":  func(ft *fakeT) { r.AssertCounter(ft, "hits", 5) },
+		"counter absent": func(ft *fakeT) { r.AssertCounter(ft, "temp", 0) },
+		"gauge value":    func(ft *fakeT) { r.AssertGauge(ft, "temp", 20) },
+		"gauge absent":   func(ft *fakeT) { r.AssertGauge(ft, "hits", 0) },
+		"not received":   func(ft *fakeT) { r.AssertReceived(ft, "latency", "c") },
+		"wait":           func(ft *fakeT) { r.WaitMetrics(ft, 10, 10*time.Millisecond) },
+	} {
+		ft := &fakeT{}
+		check(ft)
+		if !ft.Failed() {
+			t.Errorf("%s: want failure", name)
+		}
+	}
+}
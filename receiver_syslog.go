@@ -0,0 +1,177 @@
+package testutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SyslogMessage is a syslog message parsed by SyslogReceiver. Fields missing in the message,
+// like "-" values of RFC5424 or the PID in RFC3164 tag, are empty.
+type SyslogMessage struct {
+	Format         string // "rfc5424" or "rfc3164"
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string // APP-NAME of RFC5424 or TAG of RFC3164
+	ProcID         string
+	MsgID          string // RFC5424 only
+	StructuredData string // RFC5424 only, raw
+	Message        string
+	Raw            string
+}
+
+// SyslogReceiver is a syslog server listening on a local UDP port, started by NewSyslogReceiver.
+type SyslogReceiver struct {
+	Addr string // host:port to send messages to
+
+	udp      *udpReceiver
+	mu       sync.Mutex
+	messages []SyslogMessage
+}
+
+// NewSyslogReceiver starts a UDP syslog receiver parsing RFC5424 and RFC3164 messages, including the
+// RFC3339 timestamps written by log/syslog, and returns it with the address to send messages to.
+// Messages failed to parse are reported as test errors. The receiver is closed when the test completes.
+func NewSyslogReceiver(t *testing.T) *SyslogReceiver {
+	t.Helper()
+	r := &SyslogReceiver{}
+	r.udp = newUDPReceiver(t, func(packet []byte) int {
+		msg, err := ParseSyslogMessage(string(packet))
+		if err != nil {
+			t.Errorf("syslog receiver: %v", err)
+			return 0
+		}
+		r.mu.Lock()
+		r.messages = append(r.messages, msg)
+		r.mu.Unlock()
+		return 1
+	})
+	r.Addr = r.udp.conn.LocalAddr().String()
+	return r
+}
+
+// Messages returns all received messages, in order.
+func (r *SyslogReceiver) Messages() []SyslogMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SyslogMessage(nil), r.messages...)
+}
+
+// WaitMessages waits for at least n messages received and returns all of them. It fails the test
+// if they are not received within timeout.
+func (r *SyslogReceiver) WaitMessages(t TestingT, n int, timeout time.Duration) []SyslogMessage {
+	t.Helper()
+	if !r.udp.wait(n, timeout) {
+		t.Errorf("want %d syslog messages within %v, got %d", n, timeout, len(r.Messages()))
+	}
+	return r.Messages()
+}
+
+// ParseSyslogMessage parses a syslog message in RFC5424 or RFC3164 format.
+func ParseSyslogMessage(raw string) (SyslogMessage, error) {
+	res := SyslogMessage{Raw: raw}
+	line := strings.TrimRight(raw, "\r\n\x00")
+	end := strings.IndexByte(line, '>')
+	if !strings.HasPrefix(line, "<") || end < 2 {
+		return res, fmt.Errorf("no priority in syslog message %q", raw)
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return res, fmt.Errorf("invalid priority in syslog message %q", raw)
+	}
+	res.Facility, res.Severity = pri/8, pri%8
+	line = line[end+1:]
+
+	if strings.HasPrefix(line, "1 ") {
+		return parseSyslog5424(res, line[2:])
+	}
+	return parseSyslog3164(res, line)
+}
+
+func parseSyslog5424(res SyslogMessage, line string) (SyslogMessage, error) {
+	res.Format = "rfc5424"
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) < 6 {
+		return res, fmt.Errorf("incomplete rfc5424 header in %q", res.Raw)
+	}
+	nilValue := func(s string) string {
+		if s == "-" {
+			return ""
+		}
+		return s
+	}
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return res, fmt.Errorf("invalid rfc5424 timestamp in %q: %w", res.Raw, err)
+		}
+		res.Timestamp = ts
+	}
+	res.Hostname, res.AppName, res.ProcID, res.MsgID = nilValue(fields[1]), nilValue(fields[2]), nilValue(fields[3]), nilValue(fields[4])
+
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		// structured data elements, "]" is escaped as "\]" inside values
+		i := 0
+		for i < len(rest) && rest[i] == '[' {
+			for i++; i < len(rest) && rest[i] != ']'; i++ {
+				if rest[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(rest) {
+				return res, fmt.Errorf("unclosed structured data in %q", res.Raw)
+			}
+			i++
+		}
+		if i == 0 {
+			return res, fmt.Errorf("invalid structured data in %q", res.Raw)
+		}
+		res.StructuredData, rest = rest[:i], rest[i:]
+	}
+	res.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff") // optional BOM of UTF-8 message
+	return res, nil
+}
+
+func parseSyslog3164(res SyslogMessage, line string) (SyslogMessage, error) {
+	res.Format = "rfc3164"
+	// BSD timestamp like "Jan  2 15:04:05", or RFC3339 one used by log/syslog
+	if len(line) >= len(time.Stamp) {
+		if ts, err := time.Parse(time.Stamp, line[:len(time.Stamp)]); err == nil {
+			res.Timestamp = ts.AddDate(time.Now().Year(), 0, 0)
+			line = strings.TrimPrefix(line[len(time.Stamp):], " ")
+		}
+	}
+	if res.Timestamp.IsZero() {
+		if field, rest, ok := strings.Cut(line, " "); ok {
+			if ts, err := time.Parse(time.RFC3339Nano, field); err == nil {
+				res.Timestamp, line = ts, rest
+			}
+		}
+	}
+	if res.Timestamp.IsZero() {
+		return res, fmt.Errorf("invalid rfc3164 timestamp in %q", res.Raw)
+	}
+
+	// hostname is followed by the tag, the tag ends with ":" or "[pid]:"
+	if host, rest, ok := strings.Cut(line, " "); ok && !strings.HasSuffix(host, ":") && !strings.HasSuffix(host, "]") {
+		res.Hostname, line = host, rest
+	}
+	if tag, msg, ok := strings.Cut(line, ": "); ok && !strings.Contains(tag, " ") {
+		if name, pid, ok := strings.Cut(tag, "["); ok && strings.HasSuffix(pid, "]") {
+			res.AppName, res.ProcID = name, strings.TrimSuffix(pid, "]")
+		} else {
+			res.AppName = tag
+		}
+		line = msg
+	}
+	res.Message = line
+	return res, nil
+}
@@ -0,0 +1,88 @@
+package testutils
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogMessage(t *testing.T) {
+	tbl := []struct {
+		raw  string
+		want SyslogMessage
+		err  bool
+	}{
+		{raw: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventID="1011"] An application event`,
+			want: SyslogMessage{Format: "rfc5424", Facility: 20, Severity: 5, Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname: "mymachine.example.com", AppName: "evntslog", MsgID: "ID47",
+				StructuredData: `[exampleSDID@32473 iut="3" eventID="1011"]`, Message: "An application event"}},
+		{raw: `<34>1 - - su 123 - - 'su root' failed`,
+			want: SyslogMessage{Format: "rfc5424", Facility: 4, Severity: 2, AppName: "su", ProcID: "123", Message: "'su root' failed"}},
+		{raw: `<14>1 2024-01-02T03:04:05+00:00 host app - - [a x="\]"][b] msg`,
+			want: SyslogMessage{Format: "rfc5424", Facility: 1, Severity: 6, Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Hostname: "host", AppName: "app", StructuredData: `[a x="\]"][b]`, Message: "msg"}},
+		{raw: "<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8\n",
+			want: SyslogMessage{Format: "rfc3164", Facility: 4, Severity: 2, Hostname: "mymachine", AppName: "su",
+				Message: "'su root' failed for lonvick on /dev/pts/8"}},
+		{raw: "<30>2024-01-02T03:04:05Z myhost myapp[42]: started\n",
+			want: SyslogMessage{Format: "rfc3164", Facility: 3, Severity: 6, Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Hostname: "myhost", AppName: "myapp", ProcID: "42", Message: "started"}},
+		{raw: "<13>Feb  5 17:32:18 myapp[7]: no host",
+			want: SyslogMessage{Format: "rfc3164", Facility: 1, Severity: 5, AppName: "myapp", ProcID: "7", Message: "no host"}},
+		{raw: "no priority", err: true},
+		{raw: "<999>1 - - - - - - x", err: true},
+		{raw: "<14>1 bad-time host app - - - x", err: true},
+		{raw: "<14>1 - host app - - [unclosed x", err: true},
+		{raw: "<14>not a timestamp at all", err: true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseSyslogMessage(tt.raw)
+			if tt.err {
+				if err == nil {
+					t.Errorf("want error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Raw = tt.raw
+			if tt.want.Format == "rfc3164" && tt.want.Timestamp.IsZero() {
+				tt.want.Timestamp = got.Timestamp // BSD timestamp has no year, current one is used
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("want timestamp %v, got %v", tt.want.Timestamp, got.Timestamp)
+			}
+			got.Timestamp = tt.want.Timestamp
+			if got != tt.want {
+				t.Errorf("want\n%+v\ngot\n%+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSyslogReceiver(t *testing.T) {
+	r := NewSyslogReceiver(t)
+	conn, err := net.Dial("udp", r.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, msg := range []string{"<14>1 - host app - - - first", "<30>2024-01-02T03:04:05Z host app[1]: second\n"} {
+		if _, err = conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := r.WaitMessages(t, 2, time.Second)
+	if len(msgs) != 2 || msgs[0].Message != "first" || msgs[1].Message != "second" || msgs[1].ProcID != "1" {
+		t.Errorf("unexpected messages %+v", msgs)
+	}
+
+	ft := &fakeT{}
+	r.WaitMessages(ft, 3, 10*time.Millisecond)
+	if !ft.Failed() {
+		t.Error("want failure for missing messages")
+	}
+}